@@ -24,11 +24,22 @@ import (
 type ClusterSpec struct {
 	// +required
 	Cluster Message `json:"cluster"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // ClusterStatus defines the observed state of Cluster.
 type ClusterStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -60,6 +71,21 @@ func (c *Cluster) GetSpecMessage() *Message {
 	return &c.Spec.Cluster
 }
 
+// GetSpecNodes ...
+func (c *Cluster) GetSpecNodes() []string {
+	return c.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (c *Cluster) GetStatusEncoding() string {
+	return c.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (c *Cluster) SetStatusEncoding(encoding string) {
+	c.Status.Encoding = encoding
+}
+
 var _ Object = &Cluster{}
 
 // +kubebuilder:object:root=true
@@ -24,11 +24,22 @@ import (
 type ClusterLoadAssignmentSpec struct {
 	// +required
 	ClusterLoadAssignment Message `json:"clusterLoadAssignment"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // ClusterLoadAssignmentStatus defines the observed state of ClusterLoadAssignment.
 type ClusterLoadAssignmentStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -60,6 +71,21 @@ func (c *ClusterLoadAssignment) GetSpecMessage() *Message {
 	return &c.Spec.ClusterLoadAssignment
 }
 
+// GetSpecNodes ...
+func (c *ClusterLoadAssignment) GetSpecNodes() []string {
+	return c.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (c *ClusterLoadAssignment) GetStatusEncoding() string {
+	return c.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (c *ClusterLoadAssignment) SetStatusEncoding(encoding string) {
+	c.Status.Encoding = encoding
+}
+
 var _ Object = &ClusterLoadAssignment{}
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,41 @@
+/*
+Copyright 2020 VMware, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Hub marks Cluster as the conversion hub.
+func (*Cluster) Hub() {}
+
+// Hub marks ClusterLoadAssignment as the conversion hub.
+func (*ClusterLoadAssignment) Hub() {}
+
+// Hub marks Listener as the conversion hub.
+func (*Listener) Hub() {}
+
+// Hub marks RouteConfiguration as the conversion hub.
+func (*RouteConfiguration) Hub() {}
+
+// Hub marks Runtime as the conversion hub.
+func (*Runtime) Hub() {}
+
+// Hub marks ScopedRouteConfiguration as the conversion hub.
+func (*ScopedRouteConfiguration) Hub() {}
+
+// Hub marks Secret as the conversion hub.
+func (*Secret) Hub() {}
+
+// Hub marks VirtualHost as the conversion hub.
+func (*VirtualHost) Hub() {}
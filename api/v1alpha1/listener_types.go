@@ -24,11 +24,22 @@ import (
 type ListenerSpec struct {
 	// +required
 	Listener Message `json:"listener"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // ListenerStatus defines the observed state of Listener.
 type ListenerStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -60,6 +71,21 @@ func (l *Listener) GetSpecMessage() *Message {
 	return &l.Spec.Listener
 }
 
+// GetSpecNodes ...
+func (l *Listener) GetSpecNodes() []string {
+	return l.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (l *Listener) GetStatusEncoding() string {
+	return l.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (l *Listener) SetStatusEncoding(encoding string) {
+	l.Status.Encoding = encoding
+}
+
 var _ Object = &Listener{}
 
 // +kubebuilder:object:root=true
@@ -23,11 +23,22 @@ import (
 // RouteConfigurationSpec defines the desired state of RouteConfiguration.
 type RouteConfigurationSpec struct {
 	RouteConfiguration Message `json:"routeConfiguration"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // RouteConfigurationStatus defines the observed state of RouteConfiguration.
 type RouteConfigurationStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -59,6 +70,21 @@ func (c *RouteConfiguration) GetSpecMessage() *Message {
 	return &c.Spec.RouteConfiguration
 }
 
+// GetSpecNodes ...
+func (c *RouteConfiguration) GetSpecNodes() []string {
+	return c.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (c *RouteConfiguration) GetStatusEncoding() string {
+	return c.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (c *RouteConfiguration) SetStatusEncoding(encoding string) {
+	c.Status.Encoding = encoding
+}
+
 var _ Object = &RouteConfiguration{}
 
 // +kubebuilder:object:root=true
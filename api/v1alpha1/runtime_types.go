@@ -24,11 +24,22 @@ import (
 type RuntimeSpec struct {
 	// +required
 	Runtime Message `json:"listener"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // RuntimeStatus defines the observed state of Runtime.
 type RuntimeStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -60,6 +71,21 @@ func (r *Runtime) GetSpecMessage() *Message {
 	return &r.Spec.Runtime
 }
 
+// GetSpecNodes ...
+func (r *Runtime) GetSpecNodes() []string {
+	return r.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (r *Runtime) GetStatusEncoding() string {
+	return r.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (r *Runtime) SetStatusEncoding(encoding string) {
+	r.Status.Encoding = encoding
+}
+
 var _ Object = &Runtime{}
 
 // +kubebuilder:object:root=true
@@ -25,12 +25,23 @@ import (
 type ScopedRouteConfigurationSpec struct {
 	// +required
 	ScopedRouteConfiguration Message `json:"scopedRouteConfiguration"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // ScopedRouteConfigurationStatus defines the observed state of
 // ScopedRouteConfiguration.
 type ScopedRouteConfigurationStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -63,6 +74,21 @@ func (c *ScopedRouteConfiguration) GetSpecMessage() *Message {
 	return &c.Spec.ScopedRouteConfiguration
 }
 
+// GetSpecNodes ...
+func (c *ScopedRouteConfiguration) GetSpecNodes() []string {
+	return c.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (c *ScopedRouteConfiguration) GetStatusEncoding() string {
+	return c.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (c *ScopedRouteConfiguration) SetStatusEncoding(encoding string) {
+	c.Status.Encoding = encoding
+}
+
 var _ Object = &ScopedRouteConfiguration{}
 
 // +kubebuilder:object:root=true
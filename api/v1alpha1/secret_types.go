@@ -24,11 +24,22 @@ import (
 type SecretSpec struct {
 	// +required
 	Secret Message `json:"secret"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // SecretStatus defines the observed state of Secret.
 type SecretStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -60,6 +71,21 @@ func (s *Secret) GetSpecMessage() *Message {
 	return &s.Spec.Secret
 }
 
+// GetSpecNodes ...
+func (s *Secret) GetSpecNodes() []string {
+	return s.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (s *Secret) GetStatusEncoding() string {
+	return s.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (s *Secret) SetStatusEncoding(encoding string) {
+	s.Status.Encoding = encoding
+}
+
 var _ Object = &Secret{}
 
 // +kubebuilder:object:root=true
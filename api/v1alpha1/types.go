@@ -36,14 +36,57 @@ type Object interface {
 	SetStatusConditions([]Condition)
 	// GetSpecMessage returns the .Spec.Message field.
 	GetSpecMessage() *Message
+	// GetSpecNodes returns the .Spec.Nodes field.
+	GetSpecNodes() []string
+	// GetStatusEncoding returns the .Status.Encoding field.
+	GetStatusEncoding() string
+	// SetStatusEncoding sets the .Status.Encoding field.
+	SetStatusEncoding(string)
 }
 
-// Message is a protobuf Any message.
+const (
+	// MessageEncodingBinary is the encoding of a Message that
+	// holds a binary protobuf value.
+	MessageEncodingBinary = "Binary"
+
+	// MessageEncodingJSON is the encoding of a Message that holds
+	// the protobuf JSON form of the message.
+	MessageEncodingJSON = "JSON"
+)
+
+// Message is a protobuf Any message. The message is either encoded as
+// a protobuf type URL and binary value, or as a structured object in
+// the protobuf JSON format. Since YAML is converted to JSON, the
+// structured form can also be written as YAML.
 //
 // https://developers.google.com/protocol-buffers/docs/proto3#any
+// https://developers.google.com/protocol-buffers/docs/proto3#json
 type Message struct {
-	Type  string `json:"type"`
-	Value []byte `json:"value"`
+	// Type is the protobuf type URL of the binary value.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Value is the binary protobuf encoding of the message.
+	// +optional
+	Value []byte `json:"value,omitempty"`
+
+	// JSON is the protobuf JSON form of the message. Like a JSON
+	// protobuf Any, the type of the message is given by the "@type"
+	// field.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	JSON *runtime.RawExtension `json:"json,omitempty"`
+}
+
+// Encoding returns the encoding of the message, which is
+// MessageEncodingJSON if it has a JSON form, and
+// MessageEncodingBinary otherwise.
+func (m *Message) Encoding() string {
+	if m.JSON != nil && len(m.JSON.Raw) > 0 {
+		return MessageEncodingJSON
+	}
+
+	return MessageEncodingBinary
 }
 
 // Condition is a general Status condition.
@@ -24,11 +24,22 @@ import (
 type VirtualHostSpec struct {
 	// +required
 	VirtualHost Message `json:"virtualHost"`
+
+	// Nodes lists the Envoy node clusters that this resource is
+	// published to. If it is empty, the resource is published to
+	// all Envoy nodes.
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
 }
 
 // VirtualHostStatus defines the observed state of VirtualHost.
 type VirtualHostStatus struct {
 	Conditions []Condition `json:"conditions"`
+
+	// Encoding is the encoding of the spec message that was
+	// accepted, either "Binary" or "JSON".
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -36,6 +47,10 @@ type VirtualHostStatus struct {
 
 // VirtualHost is the Schema for the virtualhosts API.
 //
+// Virtual hosts are served over VHDS (v3 only), so the Envoy name of
+// a virtual host must have the form "<route configuration>/<name>",
+// where the route configuration is the one that enables VHDS.
+//
 // https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/operations/dynamic_configuration.html#vhds
 type VirtualHost struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -45,6 +60,38 @@ type VirtualHost struct {
 	Status VirtualHostStatus `json:"status,omitempty"`
 }
 
+// GetStatusConditions ...
+func (v *VirtualHost) GetStatusConditions() []Condition {
+	return v.Status.Conditions
+}
+
+// SetStatusConditions ...
+func (v *VirtualHost) SetStatusConditions(conditions []Condition) {
+	v.Status.Conditions = conditions
+}
+
+// GetSpecMessage ...
+func (v *VirtualHost) GetSpecMessage() *Message {
+	return &v.Spec.VirtualHost
+}
+
+// GetSpecNodes ...
+func (v *VirtualHost) GetSpecNodes() []string {
+	return v.Spec.Nodes
+}
+
+// GetStatusEncoding ...
+func (v *VirtualHost) GetStatusEncoding() string {
+	return v.Status.Encoding
+}
+
+// SetStatusEncoding ...
+func (v *VirtualHost) SetStatusEncoding(encoding string) {
+	v.Status.Encoding = encoding
+}
+
+var _ Object = &VirtualHost{}
+
 // +kubebuilder:object:root=true
 
 // VirtualHostList contains a list of VirtualHost.
@@ -130,6 +130,11 @@ func (in *ClusterLoadAssignmentList) DeepCopyObject() runtime.Object {
 func (in *ClusterLoadAssignmentSpec) DeepCopyInto(out *ClusterLoadAssignmentSpec) {
 	*out = *in
 	in.ClusterLoadAssignment.DeepCopyInto(&out.ClusterLoadAssignment)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLoadAssignmentSpec.
@@ -168,6 +173,11 @@ func (in *ClusterLoadAssignmentStatus) DeepCopy() *ClusterLoadAssignmentStatus {
 func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	*out = *in
 	in.Cluster.DeepCopyInto(&out.Cluster)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSpec.
@@ -281,6 +291,11 @@ func (in *ListenerList) DeepCopyObject() runtime.Object {
 func (in *ListenerSpec) DeepCopyInto(out *ListenerSpec) {
 	*out = *in
 	in.Listener.DeepCopyInto(&out.Listener)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ListenerSpec.
@@ -323,6 +338,11 @@ func (in *Message) DeepCopyInto(out *Message) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.JSON != nil {
+		in, out := &in.JSON, &out.JSON
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Message.
@@ -398,6 +418,11 @@ func (in *RouteConfigurationList) DeepCopyObject() runtime.Object {
 func (in *RouteConfigurationSpec) DeepCopyInto(out *RouteConfigurationSpec) {
 	*out = *in
 	in.RouteConfiguration.DeepCopyInto(&out.RouteConfiguration)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteConfigurationSpec.
@@ -495,6 +520,11 @@ func (in *RuntimeList) DeepCopyObject() runtime.Object {
 func (in *RuntimeSpec) DeepCopyInto(out *RuntimeSpec) {
 	*out = *in
 	in.Runtime.DeepCopyInto(&out.Runtime)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeSpec.
@@ -592,6 +622,11 @@ func (in *ScopedRouteConfigurationList) DeepCopyObject() runtime.Object {
 func (in *ScopedRouteConfigurationSpec) DeepCopyInto(out *ScopedRouteConfigurationSpec) {
 	*out = *in
 	in.ScopedRouteConfiguration.DeepCopyInto(&out.ScopedRouteConfiguration)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScopedRouteConfigurationSpec.
@@ -689,6 +724,11 @@ func (in *SecretList) DeepCopyObject() runtime.Object {
 func (in *SecretSpec) DeepCopyInto(out *SecretSpec) {
 	*out = *in
 	in.Secret.DeepCopyInto(&out.Secret)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretSpec.
@@ -786,6 +826,11 @@ func (in *VirtualHostList) DeepCopyObject() runtime.Object {
 func (in *VirtualHostSpec) DeepCopyInto(out *VirtualHostSpec) {
 	*out = *in
 	in.VirtualHost.DeepCopyInto(&out.VirtualHost)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualHostSpec.
@@ -0,0 +1,359 @@
+/*
+Copyright 2020 VMware, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+
+	"github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// MessageEncodingAnnotation records the encoding of a v1alpha1
+// message that was converted to the JSON form, so that converting it
+// back restores the original encoding.
+const MessageEncodingAnnotation = "envoy.projectcontour.io/message-encoding"
+
+// messageToHub converts a message in the protobuf JSON format to a
+// v1alpha1 message. The message keeps the JSON form unless it was
+// converted from the binary encoding, in which case it is re-encoded.
+// If the message can't be decoded, it is kept in the JSON form so that
+// the controller can report why.
+func messageToHub(src *runtime.RawExtension, dst *v1alpha1.Message, meta *metav1.ObjectMeta) error {
+	*dst = v1alpha1.Message{}
+
+	encoding := meta.Annotations[MessageEncodingAnnotation]
+	setEncodingAnnotation(meta, "")
+
+	if len(src.Raw) == 0 {
+		return nil
+	}
+
+	if encoding != v1alpha1.MessageEncodingBinary {
+		dst.JSON = src.DeepCopy()
+		return nil
+	}
+
+	message, err := xds.UnmarshalJSON(src.Raw)
+	if err != nil {
+		dst.JSON = src.DeepCopy()
+		return nil
+	}
+
+	anyMessage, err := xds.MarshalAny(message)
+	if err != nil {
+		return err
+	}
+
+	dst.Type = anyMessage.GetTypeUrl()
+	dst.Value = anyMessage.GetValue()
+
+	return nil
+}
+
+// messageFromHub converts a v1alpha1 message to the protobuf JSON
+// format. Binary messages are decoded, so their type must be known,
+// and their encoding is recorded in MessageEncodingAnnotation.
+func messageFromHub(src *v1alpha1.Message, dst *runtime.RawExtension, meta *metav1.ObjectMeta) error {
+	*dst = runtime.RawExtension{}
+
+	setEncodingAnnotation(meta, "")
+
+	switch {
+	case src.Encoding() == v1alpha1.MessageEncodingJSON:
+		src.JSON.DeepCopyInto(dst)
+		return nil
+	case src.Type == "" && len(src.Value) == 0:
+		return nil
+	}
+
+	message, err := xds.UnmarshalAny(&xds.Any{TypeUrl: src.Type, Value: src.Value})
+	if err != nil {
+		return fmt.Errorf("failed to decode %q message: %w", src.Type, err)
+	}
+
+	data, err := xds.MarshalJSON(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode %q message: %w", src.Type, err)
+	}
+
+	dst.Raw = data
+	setEncodingAnnotation(meta, v1alpha1.MessageEncodingBinary)
+
+	return nil
+}
+
+// setEncodingAnnotation sets MessageEncodingAnnotation, or removes it
+// if the encoding is empty. The annotations are copied, since the
+// converted objects share them.
+func setEncodingAnnotation(meta *metav1.ObjectMeta, encoding string) {
+	annotations := make(map[string]string, len(meta.Annotations)+1)
+
+	for k, v := range meta.Annotations {
+		if k != MessageEncodingAnnotation {
+			annotations[k] = v
+		}
+	}
+
+	if encoding != "" {
+		annotations[MessageEncodingAnnotation] = encoding
+	}
+
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+
+	meta.Annotations = annotations
+}
+
+func conditionsToHub(conditions []Condition) []v1alpha1.Condition {
+	if conditions == nil {
+		return nil
+	}
+
+	converted := make([]v1alpha1.Condition, 0, len(conditions))
+	for _, c := range conditions {
+		converted = append(converted, v1alpha1.Condition(c))
+	}
+
+	return converted
+}
+
+func conditionsFromHub(conditions []v1alpha1.Condition) []Condition {
+	if conditions == nil {
+		return nil
+	}
+
+	converted := make([]Condition, 0, len(conditions))
+	for _, c := range conditions {
+		converted = append(converted, Condition(c))
+	}
+
+	return converted
+}
+
+// ConvertTo converts this Cluster to the hub version.
+func (c *Cluster) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Cluster)
+
+	dst.ObjectMeta = c.ObjectMeta
+	dst.Spec.Nodes = c.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(c.Status.Conditions)
+	dst.Status.Encoding = c.Status.Encoding
+
+	return messageToHub(&c.Spec.Cluster, &dst.Spec.Cluster, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this Cluster.
+func (c *Cluster) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Cluster)
+
+	c.ObjectMeta = src.ObjectMeta
+	c.Spec.Nodes = src.Spec.Nodes
+	c.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	c.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.Cluster, &c.Spec.Cluster, &c.ObjectMeta)
+}
+
+var _ conversion.Convertible = &Cluster{}
+
+// ConvertTo converts this ClusterLoadAssignment to the hub version.
+func (c *ClusterLoadAssignment) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.ClusterLoadAssignment)
+
+	dst.ObjectMeta = c.ObjectMeta
+	dst.Spec.Nodes = c.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(c.Status.Conditions)
+	dst.Status.Encoding = c.Status.Encoding
+
+	return messageToHub(&c.Spec.ClusterLoadAssignment, &dst.Spec.ClusterLoadAssignment, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this ClusterLoadAssignment.
+func (c *ClusterLoadAssignment) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.ClusterLoadAssignment)
+
+	c.ObjectMeta = src.ObjectMeta
+	c.Spec.Nodes = src.Spec.Nodes
+	c.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	c.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.ClusterLoadAssignment, &c.Spec.ClusterLoadAssignment, &c.ObjectMeta)
+}
+
+var _ conversion.Convertible = &ClusterLoadAssignment{}
+
+// ConvertTo converts this Listener to the hub version.
+func (l *Listener) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Listener)
+
+	dst.ObjectMeta = l.ObjectMeta
+	dst.Spec.Nodes = l.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(l.Status.Conditions)
+	dst.Status.Encoding = l.Status.Encoding
+
+	return messageToHub(&l.Spec.Listener, &dst.Spec.Listener, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this Listener.
+func (l *Listener) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Listener)
+
+	l.ObjectMeta = src.ObjectMeta
+	l.Spec.Nodes = src.Spec.Nodes
+	l.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	l.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.Listener, &l.Spec.Listener, &l.ObjectMeta)
+}
+
+var _ conversion.Convertible = &Listener{}
+
+// ConvertTo converts this RouteConfiguration to the hub version.
+func (c *RouteConfiguration) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.RouteConfiguration)
+
+	dst.ObjectMeta = c.ObjectMeta
+	dst.Spec.Nodes = c.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(c.Status.Conditions)
+	dst.Status.Encoding = c.Status.Encoding
+
+	return messageToHub(&c.Spec.RouteConfiguration, &dst.Spec.RouteConfiguration, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this RouteConfiguration.
+func (c *RouteConfiguration) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.RouteConfiguration)
+
+	c.ObjectMeta = src.ObjectMeta
+	c.Spec.Nodes = src.Spec.Nodes
+	c.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	c.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.RouteConfiguration, &c.Spec.RouteConfiguration, &c.ObjectMeta)
+}
+
+var _ conversion.Convertible = &RouteConfiguration{}
+
+// ConvertTo converts this Runtime to the hub version.
+func (r *Runtime) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Runtime)
+
+	dst.ObjectMeta = r.ObjectMeta
+	dst.Spec.Nodes = r.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(r.Status.Conditions)
+	dst.Status.Encoding = r.Status.Encoding
+
+	return messageToHub(&r.Spec.Runtime, &dst.Spec.Runtime, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this Runtime.
+func (r *Runtime) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Runtime)
+
+	r.ObjectMeta = src.ObjectMeta
+	r.Spec.Nodes = src.Spec.Nodes
+	r.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	r.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.Runtime, &r.Spec.Runtime, &r.ObjectMeta)
+}
+
+var _ conversion.Convertible = &Runtime{}
+
+// ConvertTo converts this ScopedRouteConfiguration to the hub version.
+func (c *ScopedRouteConfiguration) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.ScopedRouteConfiguration)
+
+	dst.ObjectMeta = c.ObjectMeta
+	dst.Spec.Nodes = c.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(c.Status.Conditions)
+	dst.Status.Encoding = c.Status.Encoding
+
+	return messageToHub(&c.Spec.ScopedRouteConfiguration, &dst.Spec.ScopedRouteConfiguration, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this ScopedRouteConfiguration.
+func (c *ScopedRouteConfiguration) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.ScopedRouteConfiguration)
+
+	c.ObjectMeta = src.ObjectMeta
+	c.Spec.Nodes = src.Spec.Nodes
+	c.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	c.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.ScopedRouteConfiguration, &c.Spec.ScopedRouteConfiguration, &c.ObjectMeta)
+}
+
+var _ conversion.Convertible = &ScopedRouteConfiguration{}
+
+// ConvertTo converts this Secret to the hub version.
+func (s *Secret) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Secret)
+
+	dst.ObjectMeta = s.ObjectMeta
+	dst.Spec.Nodes = s.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(s.Status.Conditions)
+	dst.Status.Encoding = s.Status.Encoding
+
+	return messageToHub(&s.Spec.Secret, &dst.Spec.Secret, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this Secret.
+func (s *Secret) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Secret)
+
+	s.ObjectMeta = src.ObjectMeta
+	s.Spec.Nodes = src.Spec.Nodes
+	s.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	s.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.Secret, &s.Spec.Secret, &s.ObjectMeta)
+}
+
+var _ conversion.Convertible = &Secret{}
+
+// ConvertTo converts this VirtualHost to the hub version.
+func (v *VirtualHost) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.VirtualHost)
+
+	dst.ObjectMeta = v.ObjectMeta
+	dst.Spec.Nodes = v.Spec.Nodes
+	dst.Status.Conditions = conditionsToHub(v.Status.Conditions)
+	dst.Status.Encoding = v.Status.Encoding
+
+	return messageToHub(&v.Spec.VirtualHost, &dst.Spec.VirtualHost, &dst.ObjectMeta)
+}
+
+// ConvertFrom converts the hub version to this VirtualHost.
+func (v *VirtualHost) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.VirtualHost)
+
+	v.ObjectMeta = src.ObjectMeta
+	v.Spec.Nodes = src.Spec.Nodes
+	v.Status.Conditions = conditionsFromHub(src.Status.Conditions)
+	v.Status.Encoding = src.Status.Encoding
+
+	return messageFromHub(&src.Spec.VirtualHost, &v.Spec.VirtualHost, &v.ObjectMeta)
+}
+
+var _ conversion.Convertible = &VirtualHost{}
@@ -0,0 +1,88 @@
+package v1alpha2
+
+import (
+	"testing"
+
+	"github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestConversionKeepsEncoding(t *testing.T) {
+	cluster := &clusterV3.Cluster{Name: "one"}
+
+	anyMessage, err := xds.MarshalAny(cluster)
+	require.NoError(t, err)
+
+	data, err := xds.MarshalJSON(cluster)
+	require.NoError(t, err)
+
+	messages := map[string]v1alpha1.Message{
+		v1alpha1.MessageEncodingBinary: {
+			Type:  anyMessage.GetTypeUrl(),
+			Value: anyMessage.GetValue(),
+		},
+		v1alpha1.MessageEncodingJSON: {
+			JSON: &runtime.RawExtension{Raw: data},
+		},
+	}
+
+	for encoding, message := range messages {
+		hub := &v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "one",
+				Annotations: map[string]string{"example.com/note": "kept"},
+			},
+			Spec: v1alpha1.ClusterSpec{Cluster: message},
+		}
+
+		spoke := &Cluster{}
+		require.NoError(t, spoke.ConvertFrom(hub), encoding)
+
+		// The spoke message is always in the JSON form.
+		decoded, err := xds.UnmarshalJSON(spoke.Spec.Cluster.Raw)
+		require.NoError(t, err, encoding)
+		assert.True(t, proto.Equal(cluster, decoded), encoding)
+
+		converted := &v1alpha1.Cluster{}
+		require.NoError(t, spoke.ConvertTo(converted), encoding)
+
+		assert.Equal(t, encoding, converted.Spec.Cluster.Encoding())
+		assert.Equal(t, hub.Annotations, converted.Annotations, encoding)
+		assert.Equal(t, map[string]string{"example.com/note": "kept"}, hub.Annotations, encoding)
+
+		roundTripped, err := decodeHubMessage(&converted.Spec.Cluster)
+		require.NoError(t, err, encoding)
+		assert.True(t, proto.Equal(cluster, roundTripped), encoding)
+	}
+}
+
+func TestConversionOfNewObjects(t *testing.T) {
+	spoke := &Cluster{
+		Spec: ClusterSpec{
+			Cluster: runtime.RawExtension{
+				Raw: []byte(`{"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "one"}`),
+			},
+		},
+	}
+
+	// Objects written in the JSON form stay in the JSON form.
+	hub := &v1alpha1.Cluster{}
+	require.NoError(t, spoke.ConvertTo(hub))
+	assert.Equal(t, v1alpha1.MessageEncodingJSON, hub.Spec.Cluster.Encoding())
+	assert.Nil(t, hub.Annotations)
+}
+
+func decodeHubMessage(m *v1alpha1.Message) (proto.Message, error) {
+	if m.Encoding() == v1alpha1.MessageEncodingJSON {
+		return xds.UnmarshalJSON(m.JSON.Raw)
+	}
+
+	return xds.UnmarshalAny(&xds.Any{TypeUrl: m.Type, Value: m.Value})
+}
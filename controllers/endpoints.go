@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointV3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// EndpointsAnnotation selects the Services whose endpoints are
+	// published as ClusterLoadAssignments when it is set to "true".
+	EndpointsAnnotation = "envoy.projectcontour.io/eds"
+
+	// EndpointsNameAnnotation sets the Envoy cluster name of the
+	// ClusterLoadAssignments published for a Service. The default is
+	// the name of the Service. Services with more than one port
+	// publish a ClusterLoadAssignment for each port, named by
+	// appending ":" and the port name.
+	EndpointsNameAnnotation = "envoy.projectcontour.io/eds-name"
+
+	// EndpointsNodesAnnotation is a comma-separated list of the Envoy
+	// node clusters to publish the ClusterLoadAssignments to. The
+	// default is to publish them to all nodes.
+	EndpointsNodesAnnotation = "envoy.projectcontour.io/eds-nodes"
+)
+
+// EndpointReconciler publishes the endpoints of Kubernetes Services as
+// Envoy ClusterLoadAssignments.
+type EndpointReconciler struct {
+	client.Client
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	ResourceStore xds.ResourceStore
+
+	// NamingPolicy is applied to every published ClusterLoadAssignment.
+	NamingPolicy xds.NamingPolicy
+
+	lock      sync.Mutex
+	published map[types.NamespacedName][]xds.ResourceName
+}
+
+// endpointsResourceNameOf returns the name that the
+// ClusterLoadAssignment for the given port of the named Service is
+// stored under in the ResourceStore.
+func endpointsResourceNameOf(name types.NamespacedName, port string) xds.ResourceName {
+	return xds.ResourceName(
+		strings.ToLower(path.Join(name.Namespace, "core.service", name.Name, port)),
+	)
+}
+
+// TranslateEndpoints translates the EndpointSlices of a Kubernetes
+// Service to an Envoy ClusterLoadAssignment for each Service port. The
+// EndpointSlice ports are matched to the Service ports by name. Ready
+// endpoints are healthy and other endpoints are unhealthy. Endpoints
+// are grouped into localities by their region and zone. The returned
+// map is keyed by the Service port name.
+func TranslateEndpoints(
+	svc *corev1.Service,
+	slices []discoveryv1beta1.EndpointSlice,
+) map[string]*endpointV3.ClusterLoadAssignment {
+	name := svc.Name
+	if n, ok := svc.Annotations[EndpointsNameAnnotation]; ok {
+		name = n
+	}
+
+	assignments := map[string]*endpointV3.ClusterLoadAssignment{}
+
+	for _, sp := range svc.Spec.Ports {
+		cla := &endpointV3.ClusterLoadAssignment{ClusterName: name}
+		if len(svc.Spec.Ports) > 1 {
+			cla.ClusterName = name + ":" + sp.Name
+		}
+
+		localities := map[locality]*endpointV3.LocalityLbEndpoints{}
+		seen := map[string]bool{}
+
+		for _, slice := range slices {
+			// Envoy can only load balance to IP addresses.
+			if slice.AddressType != discoveryv1beta1.AddressTypeIPv4 &&
+				slice.AddressType != discoveryv1beta1.AddressTypeIPv6 {
+				continue
+			}
+
+			port, ok := slicePortFor(slice.Ports, sp.Name)
+			if !ok {
+				continue
+			}
+
+			for _, ep := range slice.Endpoints {
+				loc := locality{
+					Region: ep.Topology[corev1.LabelZoneRegionStable],
+					Zone:   ep.Topology[corev1.LabelZoneFailureDomainStable],
+				}
+
+				// A nil ready condition means that readiness
+				// is unknown, which should be treated as ready.
+				health := coreV3.HealthStatus_HEALTHY
+				if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+					health = coreV3.HealthStatus_UNHEALTHY
+				}
+
+				for _, addr := range ep.Addresses {
+					key := fmt.Sprintf("%s/%d", addr, port.Port)
+					if seen[key] {
+						continue
+					}
+
+					seen[key] = true
+
+					l, ok := localities[loc]
+					if !ok {
+						l = &endpointV3.LocalityLbEndpoints{
+							Locality: &coreV3.Locality{Region: loc.Region, Zone: loc.Zone},
+						}
+						localities[loc] = l
+					}
+
+					l.LbEndpoints = append(l.LbEndpoints, &endpointV3.LbEndpoint{
+						HealthStatus: health,
+						HostIdentifier: &endpointV3.LbEndpoint_Endpoint{
+							Endpoint: &endpointV3.Endpoint{
+								Address: &coreV3.Address{
+									Address: &coreV3.Address_SocketAddress{
+										SocketAddress: &coreV3.SocketAddress{
+											Protocol: port.Protocol,
+											Address:  addr,
+											PortSpecifier: &coreV3.SocketAddress_PortValue{
+												PortValue: port.Port,
+											},
+										},
+									},
+								},
+							},
+						},
+					})
+				}
+			}
+		}
+
+		for _, l := range localities {
+			sortEndpoints(l.LbEndpoints)
+			cla.Endpoints = append(cla.Endpoints, l)
+		}
+
+		// Sort so that unchanged endpoints don't churn Envoy.
+		sort.Slice(cla.Endpoints, func(i, j int) bool {
+			a, b := cla.Endpoints[i].GetLocality(), cla.Endpoints[j].GetLocality()
+			if a.GetRegion() != b.GetRegion() {
+				return a.GetRegion() < b.GetRegion()
+			}
+
+			return a.GetZone() < b.GetZone()
+		})
+
+		assignments[sp.Name] = cla
+	}
+
+	return assignments
+}
+
+// locality is the topology of an endpoint.
+type locality struct {
+	Region string
+	Zone   string
+}
+
+// slicePort is an EndpointSlice port in Envoy terms.
+type slicePort struct {
+	Port     uint32
+	Protocol coreV3.SocketAddress_Protocol
+}
+
+// slicePortFor returns the EndpointSlice port with the given name.
+func slicePortFor(ports []discoveryv1beta1.EndpointPort, name string) (slicePort, bool) {
+	for _, p := range ports {
+		if p.Port == nil || (p.Name == nil && name != "") || (p.Name != nil && *p.Name != name) {
+			continue
+		}
+
+		switch {
+		case p.Protocol == nil, *p.Protocol == corev1.ProtocolTCP:
+			return slicePort{Port: uint32(*p.Port), Protocol: coreV3.SocketAddress_TCP}, true
+		case *p.Protocol == corev1.ProtocolUDP:
+			return slicePort{Port: uint32(*p.Port), Protocol: coreV3.SocketAddress_UDP}, true
+		}
+	}
+
+	return slicePort{}, false
+}
+
+func sortEndpoints(endpoints []*endpointV3.LbEndpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		a := endpoints[i].GetEndpoint().GetAddress().GetSocketAddress()
+		b := endpoints[j].GetEndpoint().GetAddress().GetSocketAddress()
+		if a.GetAddress() != b.GetAddress() {
+			return a.GetAddress() < b.GetAddress()
+		}
+
+		return a.GetPortValue() < b.GetPortValue()
+	})
+}
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+
+// Reconcile publishes the ClusterLoadAssignments for a selected
+// Service. ClusterLoadAssignments for Services that are deleted, are no
+// longer selected, or no longer have the port, are removed.
+func (e *EndpointReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := e.Log.WithValues("name", req.NamespacedName)
+
+	svc := &corev1.Service{}
+
+	if err := e.Get(ctx, req.NamespacedName, svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("deleting endpoints")
+			e.publish(req.NamespacedName, nil)
+			return ctrl.Result{}, nil
+		}
+
+		log.Error(err, "failed to fetch object")
+		return ctrl.Result{}, err
+	}
+
+	if svc.Annotations[EndpointsAnnotation] != "true" {
+		e.publish(req.NamespacedName, nil)
+		return ctrl.Result{}, nil
+	}
+
+	slices := &discoveryv1beta1.EndpointSliceList{}
+	if err := e.List(ctx, slices,
+		client.InNamespace(svc.Namespace),
+		client.MatchingLabels{discoveryv1beta1.LabelServiceName: svc.Name},
+	); err != nil {
+		log.Error(err, "failed to list endpoint slices")
+		return ctrl.Result{}, err
+	}
+
+	assignments := TranslateEndpoints(svc, slices.Items)
+	nodes := nodesOf(svc.Annotations[EndpointsNodesAnnotation])
+
+	var names []xds.ResourceName
+
+	for port, cla := range assignments {
+		name := endpointsResourceNameOf(req.NamespacedName, port)
+		log := log.WithValues("resource", name)
+
+		// A rejected update leaves the previously published version
+		// of the ClusterLoadAssignment in place.
+		err := xds.Validate(cla)
+		if err == nil {
+			err = e.NamingPolicy.Apply(cla, path.Join(svc.Namespace, cla.GetClusterName()))
+		}
+
+		if err == nil {
+			// The Service version doesn't change when its
+			// endpoints change, but the store only compares
+			// the resource contents.
+			err = e.ResourceStore.UpdateResource(name, versionOf(svc), nodes, cla)
+		}
+
+		if err != nil {
+			log.Info("rejected endpoints", "message", err.Error())
+			e.ResourceStore.RejectResource(name)
+		} else {
+			log.Info("accepted endpoints", "endpoints", len(cla.GetEndpoints()))
+		}
+
+		names = append(names, name)
+	}
+
+	e.publish(req.NamespacedName, names)
+
+	return ctrl.Result{}, nil
+}
+
+// publish records the resources that are published for the named
+// Service, and deletes the resources that were previously published
+// but no longer are.
+func (e *EndpointReconciler) publish(svc types.NamespacedName, names []xds.ResourceName) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	current := map[xds.ResourceName]bool{}
+	for _, n := range names {
+		current[n] = true
+	}
+
+	for _, n := range e.published[svc] {
+		if !current[n] {
+			e.ResourceStore.DeleteResource(n)
+		}
+	}
+
+	if len(names) == 0 {
+		delete(e.published, svc)
+		return
+	}
+
+	e.published[svc] = names
+}
+
+// ResourceNames returns the names that the ClusterLoadAssignments
+// for the selected Services are stored under in the ResourceStore.
+func (e *EndpointReconciler) ResourceNames(ctx context.Context) ([]xds.ResourceName, error) {
+	services := &corev1.ServiceList{}
+	if err := e.List(ctx, services); err != nil {
+		return nil, err
+	}
+
+	var names []xds.ResourceName
+
+	for _, svc := range services.Items {
+		if svc.Annotations[EndpointsAnnotation] != "true" {
+			continue
+		}
+
+		for _, sp := range svc.Spec.Ports {
+			names = append(names, endpointsResourceNameOf(
+				types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, sp.Name))
+		}
+	}
+
+	return names, nil
+}
+
+// WaitForCacheSync waits until the cache has synced the Services and
+// EndpointSlices.
+func (e *EndpointReconciler) WaitForCacheSync(ctx context.Context, c cache.Cache) error {
+	return waitForCacheSync(ctx, c, &corev1.Service{}, &discoveryv1beta1.EndpointSlice{})
+}
+
+// SetupWithManager ...
+func (e *EndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	e.published = map[types.NamespacedName][]xds.ResourceName{}
+
+	// Reconcile the owning Service when its EndpointSlices change.
+	toService := handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+		svc, ok := o.Meta.GetLabels()[discoveryv1beta1.LabelServiceName]
+		if !ok {
+			return nil
+		}
+
+		return []reconcile.Request{{
+			NamespacedName: types.NamespacedName{Namespace: o.Meta.GetNamespace(), Name: svc},
+		}}
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("endpoints").
+		For(&corev1.Service{}).
+		Watches(&source.Kind{Type: &discoveryv1beta1.EndpointSlice{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: toService}).
+		Complete(e)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"testing"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointV3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestTranslateEndpoints(t *testing.T) {
+	ready := true
+	notReady := false
+	port8080 := int32(8080)
+
+	port := func(name string, number int32) discoveryv1beta1.EndpointPort {
+		return discoveryv1beta1.EndpointPort{Name: &name, Port: &number}
+	}
+
+	slice := func(
+		ports []discoveryv1beta1.EndpointPort, endpoints ...discoveryv1beta1.Endpoint,
+	) discoveryv1beta1.EndpointSlice {
+		return discoveryv1beta1.EndpointSlice{
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			Ports:       ports,
+			Endpoints:   endpoints,
+		}
+	}
+
+	lbEndpoint := func(addr string, port uint32, health coreV3.HealthStatus) *endpointV3.LbEndpoint {
+		return &endpointV3.LbEndpoint{
+			HealthStatus: health,
+			HostIdentifier: &endpointV3.LbEndpoint_Endpoint{
+				Endpoint: &endpointV3.Endpoint{
+					Address: &coreV3.Address{
+						Address: &coreV3.Address_SocketAddress{
+							SocketAddress: &coreV3.SocketAddress{
+								Protocol:      coreV3.SocketAddress_TCP,
+								Address:       addr,
+								PortSpecifier: &coreV3.SocketAddress_PortValue{PortValue: port},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	locality := func(region, zone string, endpoints ...*endpointV3.LbEndpoint) *endpointV3.LocalityLbEndpoints {
+		return &endpointV3.LocalityLbEndpoints{
+			Locality:    &coreV3.Locality{Region: region, Zone: zone},
+			LbEndpoints: endpoints,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		ports       []corev1.ServicePort
+		slices      []discoveryv1beta1.EndpointSlice
+		want        map[string]*endpointV3.ClusterLoadAssignment
+	}{{
+		name:  "numeric target port",
+		ports: []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+		slices: []discoveryv1beta1.EndpointSlice{
+			// The port of an unnamed Service port may have no name.
+			slice([]discoveryv1beta1.EndpointPort{{Port: &port8080}},
+				discoveryv1beta1.Endpoint{Addresses: []string{"10.0.0.2", "10.0.0.1"}}),
+		},
+		want: map[string]*endpointV3.ClusterLoadAssignment{
+			"": {
+				ClusterName: "backend",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("", "",
+						lbEndpoint("10.0.0.1", 8080, coreV3.HealthStatus_HEALTHY),
+						lbEndpoint("10.0.0.2", 8080, coreV3.HealthStatus_HEALTHY)),
+				},
+			},
+		},
+	}, {
+		name:  "not ready endpoints",
+		ports: []corev1.ServicePort{{Port: 80}},
+		slices: []discoveryv1beta1.EndpointSlice{
+			slice([]discoveryv1beta1.EndpointPort{port("", 8080)},
+				discoveryv1beta1.Endpoint{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discoveryv1beta1.EndpointConditions{Ready: &ready},
+				},
+				discoveryv1beta1.Endpoint{
+					Addresses:  []string{"10.0.0.2"},
+					Conditions: discoveryv1beta1.EndpointConditions{Ready: &notReady},
+				}),
+		},
+		want: map[string]*endpointV3.ClusterLoadAssignment{
+			"": {
+				ClusterName: "backend",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("", "",
+						lbEndpoint("10.0.0.1", 8080, coreV3.HealthStatus_HEALTHY),
+						lbEndpoint("10.0.0.2", 8080, coreV3.HealthStatus_UNHEALTHY)),
+				},
+			},
+		},
+	}, {
+		name:  "multiple slices",
+		ports: []corev1.ServicePort{{Port: 80}},
+		slices: []discoveryv1beta1.EndpointSlice{
+			slice([]discoveryv1beta1.EndpointPort{port("", 8080)},
+				discoveryv1beta1.Endpoint{Addresses: []string{"10.0.0.1"}}),
+			slice([]discoveryv1beta1.EndpointPort{port("", 8080)},
+				discoveryv1beta1.Endpoint{Addresses: []string{"10.0.0.2", "10.0.0.1"}}),
+			// Envoy can't load balance to FQDN endpoints.
+			{
+				AddressType: discoveryv1beta1.AddressTypeFQDN,
+				Ports:       []discoveryv1beta1.EndpointPort{port("", 8080)},
+				Endpoints:   []discoveryv1beta1.Endpoint{{Addresses: []string{"backend.example.com"}}},
+			},
+		},
+		want: map[string]*endpointV3.ClusterLoadAssignment{
+			"": {
+				ClusterName: "backend",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("", "",
+						lbEndpoint("10.0.0.1", 8080, coreV3.HealthStatus_HEALTHY),
+						lbEndpoint("10.0.0.2", 8080, coreV3.HealthStatus_HEALTHY)),
+				},
+			},
+		},
+	}, {
+		name:        "named ports",
+		annotations: map[string]string{EndpointsNameAnnotation: "api"},
+		ports: []corev1.ServicePort{
+			// The slice has the number of the named target port.
+			{Name: "http", Port: 80, TargetPort: intstr.FromString("web")},
+			{Name: "metrics", Port: 9090},
+			{Name: "admin", Port: 9901},
+		},
+		slices: []discoveryv1beta1.EndpointSlice{
+			slice([]discoveryv1beta1.EndpointPort{port("http", 8080), port("metrics", 8000)},
+				discoveryv1beta1.Endpoint{Addresses: []string{"10.0.0.1"}}),
+		},
+		want: map[string]*endpointV3.ClusterLoadAssignment{
+			"http": {
+				ClusterName: "api:http",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("", "", lbEndpoint("10.0.0.1", 8080, coreV3.HealthStatus_HEALTHY)),
+				},
+			},
+			"metrics": {
+				ClusterName: "api:metrics",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("", "", lbEndpoint("10.0.0.1", 8000, coreV3.HealthStatus_HEALTHY)),
+				},
+			},
+			// No slice has the port, so there are no endpoints.
+			"admin": {ClusterName: "api:admin"},
+		},
+	}, {
+		name:  "localities",
+		ports: []corev1.ServicePort{{Port: 80}},
+		slices: []discoveryv1beta1.EndpointSlice{
+			slice([]discoveryv1beta1.EndpointPort{port("", 8080)},
+				discoveryv1beta1.Endpoint{
+					Addresses: []string{"10.0.1.1"},
+					Topology: map[string]string{
+						corev1.LabelZoneRegionStable:        "us-east1",
+						corev1.LabelZoneFailureDomainStable: "us-east1-b",
+					},
+				},
+				discoveryv1beta1.Endpoint{
+					Addresses: []string{"10.0.0.1"},
+					Topology: map[string]string{
+						corev1.LabelZoneRegionStable:        "us-east1",
+						corev1.LabelZoneFailureDomainStable: "us-east1-a",
+					},
+				}),
+		},
+		want: map[string]*endpointV3.ClusterLoadAssignment{
+			"": {
+				ClusterName: "backend",
+				Endpoints: []*endpointV3.LocalityLbEndpoints{
+					locality("us-east1", "us-east1-a", lbEndpoint("10.0.0.1", 8080, coreV3.HealthStatus_HEALTHY)),
+					locality("us-east1", "us-east1-b", lbEndpoint("10.0.1.1", 8080, coreV3.HealthStatus_HEALTHY)),
+				},
+			},
+		},
+	}}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "backend",
+					Annotations: tc.annotations,
+				},
+				Spec: corev1.ServiceSpec{Ports: tc.ports},
+			}
+
+			got := TranslateEndpoints(svc, tc.slices)
+
+			assert.Len(t, got, len(tc.want))
+
+			for name, want := range tc.want {
+				assert.Truef(t, proto.Equal(want, got[name]), "port %q: got %v", name, got[name])
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"strings"
@@ -13,16 +14,22 @@ import (
 
 	"github.com/go-logr/logr"
 	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var factories = []func() runtime.Object{
@@ -36,12 +43,31 @@ var factories = []func() runtime.Object{
 	func() runtime.Object { return &envoyv1alpha1.VirtualHost{} },
 }
 
-func resourceOf(name types.NamespacedName, gvk schema.GroupVersionKind) xds.ResourceName {
+// ResourceNameOf returns the name that the named object of the given
+// kind is stored under in the ResourceStore.
+func ResourceNameOf(name types.NamespacedName, gvk schema.GroupVersionKind) xds.ResourceName {
 	return xds.ResourceName(
 		strings.ToLower(path.Join(name.Namespace, gvk.Kind, name.Name)),
 	)
 }
 
+// objectOf is the inverse of ResourceNameOf, returning the kind and
+// name of the object that the resource was created from.
+func objectOf(name xds.ResourceName) (string, types.NamespacedName, bool) {
+	parts := strings.Split(string(name), "/")
+	if len(parts) != 3 {
+		return "", types.NamespacedName{}, false
+	}
+
+	for _, k := range xds.Kinds() {
+		if strings.ToLower(k) == parts[1] {
+			return k, types.NamespacedName{Namespace: parts[0], Name: parts[2]}, true
+		}
+	}
+
+	return "", types.NamespacedName{}, false
+}
+
 func versionOf(obj runtime.Object) xds.ResourceVersion {
 	metaObj := must.Object(meta.Accessor(obj))
 
@@ -51,19 +77,15 @@ func versionOf(obj runtime.Object) xds.ResourceVersion {
 	}
 }
 
-func anyOf(m *envoyv1alpha1.Message) xds.Any {
-	return xds.Any{
-		TypeUrl: m.Type,
-		Value:   m.Value,
-	}
-}
-
 // EnvoyReconciler reconciles a Listener object.
 type EnvoyReconciler struct {
 	client.Client
 	Log           logr.Logger
 	Scheme        *runtime.Scheme
 	ResourceStore xds.ResourceStore
+
+	// NamingPolicy is applied to every accepted resource.
+	NamingPolicy xds.NamingPolicy
 }
 
 // AcceptResource decides whether the given Envoy resource should be accepted.
@@ -71,17 +93,16 @@ func AcceptResource(obj envoyv1alpha1.Object, gvk schema.GroupVersionKind) (
 	proto.Message,
 	*kubernetes.AcceptanceError,
 ) {
-	any := anyOf(obj.GetSpecMessage())
+	spec := obj.GetSpecMessage()
 
-	// Verify that the type URL is acceptable for the kind.
-	if xds.KindForTypename(any.TypeUrl) != gvk.Kind {
-		return nil, &kubernetes.AcceptanceError{
-			Reason:  "TypeAmbiguity",
-			Message: fmt.Sprintf("invalid type %q for resource kind %q", any.TypeUrl, gvk.Kind),
+	// The binary form names its type, so check that before decoding.
+	if spec.Encoding() == envoyv1alpha1.MessageEncodingBinary {
+		if err := acceptType(spec.Type, gvk); err != nil {
+			return nil, err
 		}
 	}
 
-	resource, err := xds.UnmarshalAny(&any)
+	resource, err := kubernetes.DecodeMessage(spec)
 	if err != nil {
 		return nil, &kubernetes.AcceptanceError{
 			Reason:  "InvalidFormat",
@@ -89,6 +110,10 @@ func AcceptResource(obj envoyv1alpha1.Object, gvk schema.GroupVersionKind) (
 		}
 	}
 
+	if err := acceptType(xds.TypeURL(resource), gvk); err != nil {
+		return nil, err
+	}
+
 	// Run protobuf validation for the resource.
 	if err := xds.Validate(resource); err != nil {
 		return nil, &kubernetes.AcceptanceError{
@@ -100,6 +125,37 @@ func AcceptResource(obj envoyv1alpha1.Object, gvk schema.GroupVersionKind) (
 	return resource, nil
 }
 
+// ApplyNamingPolicy applies the naming policy to the Envoy resource
+// that was accepted from obj, using the qualified name of obj.
+func ApplyNamingPolicy(
+	policy xds.NamingPolicy,
+	obj envoyv1alpha1.Object,
+	resource proto.Message,
+) *kubernetes.AcceptanceError {
+	m := must.Object(meta.Accessor(obj))
+
+	if err := policy.Apply(resource, path.Join(m.GetNamespace(), m.GetName())); err != nil {
+		return &kubernetes.AcceptanceError{
+			Reason:  "InvalidName",
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// acceptType verifies that the type URL is acceptable for the kind.
+func acceptType(typeURL string, gvk schema.GroupVersionKind) *kubernetes.AcceptanceError {
+	if xds.KindForTypename(typeURL) != gvk.Kind {
+		return &kubernetes.AcceptanceError{
+			Reason:  "TypeAmbiguity",
+			Message: fmt.Sprintf("invalid type %q for resource kind %q", typeURL, gvk.Kind),
+		}
+	}
+
+	return nil
+}
+
 // nolint(lll)
 // +kubebuilder:rbac:groups=envoy.projectcontour.io,resources=clusterloadassignments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=envoy.projectcontour.io,resources=clusterloadassignments/status,verbs=get;update;patch
@@ -126,13 +182,13 @@ func (e *EnvoyReconciler) Reconcile(req ctrl.Request, o runtime.Object, gvk sche
 	log := e.Log.WithValues(
 		"kind", gvk.Kind,
 		"name", req.NamespacedName,
-		"resource", resourceOf(req.NamespacedName, gvk),
+		"resource", ResourceNameOf(req.NamespacedName, gvk),
 	)
 
 	if err := e.Get(ctx, req.NamespacedName, o); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("deleting resource")
-			e.ResourceStore.DeleteResource(resourceOf(req.NamespacedName, gvk))
+			e.ResourceStore.DeleteResource(ResourceNameOf(req.NamespacedName, gvk))
 			return ctrl.Result{}, nil
 		}
 
@@ -148,27 +204,72 @@ func (e *EnvoyReconciler) Reconcile(req ctrl.Request, o runtime.Object, gvk sche
 		return ctrl.Result{}, nil
 	}
 
+	name := ResourceNameOf(req.NamespacedName, gvk)
 	accepted := kubernetes.NewAcceptedCondition(obj)
 
 	// Do initial acceptance validation.
 	resource, err := AcceptResource(obj, gvk)
+	if err == nil {
+		err = ApplyNamingPolicy(e.NamingPolicy, obj, resource)
+	}
+
 	if err != nil {
 		accepted.Status = metav1.ConditionFalse
 		accepted.Reason = err.Reason
 		accepted.Message = err.Message
 	}
 
-	var conditions []envoyv1alpha1.Condition
+	if accepted.Status == metav1.ConditionTrue {
+		err := e.ResourceStore.UpdateResource(name, versionOf(obj), xds.NodeSelector(obj.GetSpecNodes()), resource)
+
+		var conflict *xds.NameConflictError
 
-	// Preserve all conditions except "Accepted".
-	for _, c := range obj.GetStatusConditions() {
-		if c.Type != "Accepted" {
-			conditions = append(conditions, c)
+		switch {
+		case errors.As(err, &conflict):
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = "NameConflict"
+			accepted.Message = err.Error()
+		case err != nil:
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = "StoreFailed"
+			accepted.Message = err.Error()
 		}
 	}
 
-	conditions = append(conditions, *accepted)
+	// A rejected update leaves the previously accepted version
+	// of the resource in place, so that Envoy keeps working.
+	switch accepted.Status {
+	case metav1.ConditionFalse:
+		log.Info("rejected resource", "reason", accepted.Reason, "message", accepted.Message)
+		e.ResourceStore.RejectResource(name)
+	default:
+		log.Info("accepted resource")
+	}
+
+	programmed := programmedCondition(obj, e.ResourceStore.ResourceStatus(name))
+	resolved := resolvedRefsCondition(obj, e.ResourceStore.UnresolvedReferences(name))
+
+	conditions := obj.GetStatusConditions()
+	conditions = kubernetes.SetCondition(conditions, *accepted)
+	conditions = kubernetes.SetCondition(conditions, *programmed)
+	conditions = kubernetes.SetCondition(conditions, *resolved)
+
+	// Report the encoding of the spec that we accepted, which
+	// is unchanged if we rejected it.
+	encoding := obj.GetStatusEncoding()
+	if accepted.Status == metav1.ConditionTrue {
+		encoding = obj.GetSpecMessage().Encoding()
+	}
+
+	// Don't update the status unless something changed,
+	// since the update would just trigger another reconcile.
+	if equality.Semantic.DeepEqual(conditions, obj.GetStatusConditions()) &&
+		encoding == obj.GetStatusEncoding() {
+		return ctrl.Result{}, nil
+	}
+
 	obj.SetStatusConditions(conditions)
+	obj.SetStatusEncoding(encoding)
 
 	// Update the status condition on this object. The default
 	// for new "Accepted" conditions is "True", switching to "False"
@@ -183,29 +284,104 @@ func (e *EnvoyReconciler) Reconcile(req ctrl.Request, o runtime.Object, gvk sche
 		return ctrl.Result{}, err
 	}
 
-	switch accepted.Status {
-	case metav1.ConditionFalse:
-		log.Info("rejected resource", "reason", accepted.Reason, "message", accepted.Message)
-		return ctrl.Result{}, nil
+	return ctrl.Result{}, nil
+}
+
+// programmedCondition returns a "Programmed" condition that reflects
+// whether Envoy accepted or rejected the resource, or whether it is
+// being held back from Envoy.
+func programmedCondition(obj runtime.Object, status xds.ResourceStatus) *kubernetes.Condition {
+	programmed := kubernetes.NewProgrammedCondition(obj)
+
+	switch {
+	case status.Held:
+		programmed.Status = metav1.ConditionFalse
+		programmed.Reason = "HeldBack"
+		programmed.Message = "held back from Envoy until its references resolve"
+	case len(status.Errors) > 0:
+		programmed.Status = metav1.ConditionFalse
+		programmed.Reason = "Rejected"
+		programmed.Message = strings.Join(status.Errors, "; ")
+	case status.Acked:
+		programmed.Reason = "Acknowledged"
 	default:
-		log.Info("accepted resource")
+		programmed.Status = metav1.ConditionUnknown
+		programmed.Reason = "Pending"
+		programmed.Message = "waiting for Envoy to acknowledge the resource"
+	}
 
+	return programmed
+}
+
+// resolvedRefsCondition returns a "ResolvedRefs" condition that lists
+// the resources that are referred to, but don't exist.
+func resolvedRefsCondition(obj runtime.Object, unresolved []xds.Reference) *kubernetes.Condition {
+	resolved := kubernetes.NewResolvedRefsCondition(obj)
+
+	if len(unresolved) == 0 {
+		resolved.Reason = "ResolvedRefs"
+		return resolved
 	}
 
-	log.Info("", "resource", resource)
-	e.ResourceStore.UpdateResource(resourceOf(req.NamespacedName, gvk), versionOf(obj), resource)
+	refs := make([]string, 0, len(unresolved))
+	for _, r := range unresolved {
+		refs = append(refs, r.String())
+	}
 
-	return ctrl.Result{}, nil
+	resolved.Status = metav1.ConditionFalse
+	resolved.Reason = "UnresolvedRefs"
+	resolved.Message = fmt.Sprintf("unresolved references to %s", strings.Join(refs, ", "))
+
+	return resolved
+}
+
+// ResourceNames returns the names that the Envoy resource objects
+// are stored under in the ResourceStore.
+func (e *EnvoyReconciler) ResourceNames(ctx context.Context) ([]xds.ResourceName, error) {
+	var names []xds.ResourceName
+
+	for _, factory := range factories {
+		gvk := must.GroupVersionKind(apiutil.GVKForObject(factory(), e.Scheme))
+
+		list, err := e.Scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := e.List(ctx, list); err != nil {
+			return nil, err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			m := must.Object(meta.Accessor(item))
+			names = append(names, ResourceNameOf(
+				types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}, gvk))
+		}
+	}
+
+	return names, nil
 }
 
 // SetupWithManager ...
 func (e *EnvoyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	events := map[string]chan event.GenericEvent{}
+	kinds := map[string]func() runtime.Object{}
+
 	for _, factory := range factories {
 		factory := factory
 		gvk := must.GroupVersionKind(apiutil.GVKForObject(factory(), e.Scheme))
 
+		events[gvk.Kind] = make(chan event.GenericEvent)
+		kinds[gvk.Kind] = factory
+
 		if err := ctrl.NewControllerManagedBy(mgr).
 			For(factory()).
+			Watches(&source.Channel{Source: events[gvk.Kind]}, &handler.EnqueueRequestForObject{}).
 			Complete(reconcile.Func(
 				func(req ctrl.Request) (ctrl.Result, error) {
 					obj := factory()
@@ -216,5 +392,43 @@ func (e *EnvoyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		}
 	}
 
-	return nil
+	// Requeue resources when Envoy accepts or rejects them, when
+	// a name conflict is resolved, or when the resources they refer
+	// to come or go, so that we can update their status. The names
+	// are queued, so that the xDS server never blocks on the
+	// controllers, and repeated notifications are coalesced until
+	// the controllers run, which is only on the leader.
+	queue := workqueue.New()
+
+	e.ResourceStore.Notify(func(name xds.ResourceName) {
+		queue.Add(name)
+	})
+
+	return mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		go func() {
+			<-stop
+			queue.ShutDown()
+		}()
+
+		for {
+			item, shutdown := queue.Get()
+			if shutdown {
+				return nil
+			}
+
+			if kind, nsname, ok := objectOf(item.(xds.ResourceName)); ok {
+				obj := kinds[kind]()
+				m := must.Object(meta.Accessor(obj))
+				m.SetNamespace(nsname.Namespace)
+				m.SetName(nsname.Name)
+
+				select {
+				case events[kind] <- event.GenericEvent{Meta: m, Object: obj}:
+				case <-stop:
+				}
+			}
+
+			queue.Done(item)
+		}
+	}))
 }
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// SecretNameAnnotation sets the Envoy name of the SDS secret
+	// that is published for a Kubernetes Secret. The default is the
+	// name of the Kubernetes Secret.
+	SecretNameAnnotation = "envoy.projectcontour.io/sds-name"
+
+	// SecretTypeAnnotation sets whether a Kubernetes Secret is
+	// published as a "tls-certificate" or a "validation-context".
+	// The default is chosen from the keys in the Secret.
+	SecretTypeAnnotation = "envoy.projectcontour.io/sds-type"
+
+	// SecretNodesAnnotation is a comma-separated list of the Envoy
+	// node clusters to publish the SDS secret to. The default is to
+	// publish it to all nodes.
+	SecretNodesAnnotation = "envoy.projectcontour.io/sds-nodes"
+)
+
+// SecretReconciler publishes Kubernetes Secrets as Envoy SDS secrets.
+// Only the selected Secrets are watched and cached, rather than every
+// Secret in the cluster, so the reconciler reads them from its own
+// informer instead of the manager cache.
+type SecretReconciler struct {
+	Log           logr.Logger
+	ResourceStore xds.ResourceStore
+
+	// Selector selects the Secrets to publish.
+	Selector labels.Selector
+
+	// NamingPolicy is applied to every published secret.
+	NamingPolicy xds.NamingPolicy
+
+	informer toolscache.SharedIndexInformer
+	secrets  corev1listers.SecretLister
+}
+
+// informerRunnable runs an informer that is not part of the manager
+// cache. Like the manager cache, it runs whether or not this replica
+// is the leader.
+type informerRunnable struct {
+	toolscache.SharedIndexInformer
+}
+
+// Start runs the informer until stop is closed.
+func (i informerRunnable) Start(stop <-chan struct{}) error {
+	i.Run(stop)
+	return nil
+}
+
+// NeedLeaderElection returns false.
+func (i informerRunnable) NeedLeaderElection() bool {
+	return false
+}
+
+// secretResourceNameOf returns the name that the SDS secret for the
+// named Kubernetes Secret is stored under in the ResourceStore. This
+// is distinct from the names of Envoy Secret resources, so that the
+// two kinds of object never replace each other.
+func secretResourceNameOf(name types.NamespacedName) xds.ResourceName {
+	return xds.ResourceName(
+		strings.ToLower(path.Join(name.Namespace, "core.secret", name.Name)),
+	)
+}
+
+// TranslateSecret translates a Kubernetes Secret to an Envoy SDS
+// secret. "kubernetes.io/tls" Secrets, and opaque Secrets with
+// "tls.crt" and "tls.key" keys, become TLS certificates. Opaque Secrets
+// with a "ca.crt" key (and optionally a "ca.crl" key) become
+// validation contexts. SecretTypeAnnotation overrides this choice.
+func TranslateSecret(s *corev1.Secret) (*tlsV3.Secret, error) {
+	inline := func(key string) *coreV3.DataSource {
+		return &coreV3.DataSource{
+			Specifier: &coreV3.DataSource_InlineBytes{InlineBytes: s.Data[key]},
+		}
+	}
+
+	has := func(keys ...string) bool {
+		for _, k := range keys {
+			if len(s.Data[k]) == 0 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	secretType := s.Annotations[SecretTypeAnnotation]
+	if secretType == "" {
+		switch {
+		case s.Type == corev1.SecretTypeTLS, has(corev1.TLSCertKey, corev1.TLSPrivateKeyKey):
+			secretType = "tls-certificate"
+		case has(corev1.ServiceAccountRootCAKey):
+			secretType = "validation-context"
+		default:
+			return nil, fmt.Errorf("secret has neither %q and %q keys nor a %q key",
+				corev1.TLSCertKey, corev1.TLSPrivateKeyKey, corev1.ServiceAccountRootCAKey)
+		}
+	}
+
+	name := s.Name
+	if n, ok := s.Annotations[SecretNameAnnotation]; ok {
+		name = n
+	}
+
+	secret := &tlsV3.Secret{Name: name}
+
+	switch secretType {
+	case "tls-certificate":
+		if !has(corev1.TLSCertKey, corev1.TLSPrivateKeyKey) {
+			return nil, fmt.Errorf("TLS certificate secret needs %q and %q keys",
+				corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+
+		secret.Type = &tlsV3.Secret_TlsCertificate{
+			TlsCertificate: &tlsV3.TlsCertificate{
+				CertificateChain: inline(corev1.TLSCertKey),
+				PrivateKey:       inline(corev1.TLSPrivateKeyKey),
+			},
+		}
+
+	case "validation-context":
+		if !has(corev1.ServiceAccountRootCAKey) {
+			return nil, fmt.Errorf("validation context secret needs a %q key", corev1.ServiceAccountRootCAKey)
+		}
+
+		validation := &tlsV3.CertificateValidationContext{
+			TrustedCa: inline(corev1.ServiceAccountRootCAKey),
+		}
+
+		if has("ca.crl") {
+			validation.Crl = inline("ca.crl")
+		}
+
+		secret.Type = &tlsV3.Secret_ValidationContext{ValidationContext: validation}
+
+	default:
+		return nil, fmt.Errorf("invalid %s annotation %q", SecretTypeAnnotation, secretType)
+	}
+
+	return secret, nil
+}
+
+// nodesOf parses a comma-separated nodes annotation.
+func nodesOf(annotation string) xds.NodeSelector {
+	var nodes xds.NodeSelector
+
+	for _, n := range strings.Split(annotation, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return nodes
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile publishes the SDS secret for a selected Kubernetes Secret.
+// Updating the Secret publishes the new version of the SDS secret, so
+// that certificates are rotated without restarting Envoy. Secrets that
+// are deleted, or are no longer selected, are removed.
+func (s *SecretReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	name := secretResourceNameOf(req.NamespacedName)
+	log := s.Log.WithValues("name", req.NamespacedName, "resource", name)
+
+	// A Secret that is no longer selected drops out of the
+	// informer, so it is not found either.
+	secret, err := s.secrets.Secrets(req.Namespace).Get(req.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("deleting secret")
+			s.ResourceStore.DeleteResource(name)
+			return ctrl.Result{}, nil
+		}
+
+		log.Error(err, "failed to fetch object")
+		return ctrl.Result{}, err
+	}
+
+	// A rejected update leaves the previously published version
+	// of the secret in place, so that Envoy keeps working.
+	// Objects in the informer are shared, so translate a copy.
+	secret = secret.DeepCopy()
+
+	resource, err := TranslateSecret(secret)
+	if err == nil {
+		err = xds.Validate(resource)
+	}
+
+	if err == nil {
+		err = s.NamingPolicy.Apply(resource, path.Join(secret.Namespace, secret.Name))
+	}
+
+	if err == nil {
+		nodes := nodesOf(secret.Annotations[SecretNodesAnnotation])
+		err = s.ResourceStore.UpdateResource(name, versionOf(secret), nodes, resource)
+	}
+
+	if err != nil {
+		log.Info("rejected secret", "message", err.Error())
+		s.ResourceStore.RejectResource(name)
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("accepted secret")
+
+	return ctrl.Result{}, nil
+}
+
+// ResourceNames returns the names that the selected Secrets are
+// stored under in the ResourceStore.
+func (s *SecretReconciler) ResourceNames(ctx context.Context) ([]xds.ResourceName, error) {
+	secrets, err := s.secrets.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]xds.ResourceName, 0, len(secrets))
+	for _, secret := range secrets {
+		names = append(names, secretResourceNameOf(
+			types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}))
+	}
+
+	return names, nil
+}
+
+// WaitForCacheSync waits until the informer has synced the selected
+// Secrets. The Secrets are not in the manager cache.
+func (s *SecretReconciler) WaitForCacheSync(ctx context.Context, c cache.Cache) error {
+	if !toolscache.WaitForCacheSync(ctx.Done(), s.informer.HasSynced) {
+		return errors.New("cache sync was stopped")
+	}
+
+	return nil
+}
+
+// SetupWithManager ...
+func (s *SecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if s.Selector == nil || s.Selector.Empty() {
+		return errors.New("a Secret selector is required")
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = s.Selector.String()
+		}),
+	)
+
+	secrets := factory.Core().V1().Secrets()
+	s.informer = secrets.Informer()
+	s.secrets = secrets.Lister()
+
+	if err := mgr.Add(informerRunnable{s.informer}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("secret").
+		Watches(&source.Informer{Informer: s.informer}, &handler.EnqueueRequestForObject{}).
+		Complete(s)
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"testing"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTranslateSecret(t *testing.T) {
+	inline := func(data string) *coreV3.DataSource {
+		return &coreV3.DataSource{
+			Specifier: &coreV3.DataSource_InlineBytes{InlineBytes: []byte(data)},
+		}
+	}
+
+	certificate := func(name string) *tlsV3.Secret {
+		return &tlsV3.Secret{
+			Name: name,
+			Type: &tlsV3.Secret_TlsCertificate{
+				TlsCertificate: &tlsV3.TlsCertificate{
+					CertificateChain: inline("cert"),
+					PrivateKey:       inline("key"),
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		secretType  corev1.SecretType
+		annotations map[string]string
+		data        map[string]string
+		want        *tlsV3.Secret
+		wantErr     string
+	}{{
+		name:       "TLS secret",
+		secretType: corev1.SecretTypeTLS,
+		data:       map[string]string{"tls.crt": "cert", "tls.key": "key"},
+		want:       certificate("cert"),
+	}, {
+		name:       "opaque secret with a certificate and key",
+		secretType: corev1.SecretTypeOpaque,
+		data:       map[string]string{"tls.crt": "cert", "tls.key": "key", "ca.crt": "ca"},
+		want:       certificate("cert"),
+	}, {
+		name:       "opaque secret with a CA",
+		secretType: corev1.SecretTypeOpaque,
+		data:       map[string]string{"ca.crt": "ca"},
+		want: &tlsV3.Secret{
+			Name: "cert",
+			Type: &tlsV3.Secret_ValidationContext{
+				ValidationContext: &tlsV3.CertificateValidationContext{TrustedCa: inline("ca")},
+			},
+		},
+	}, {
+		name:       "opaque secret with a CA and CRL",
+		secretType: corev1.SecretTypeOpaque,
+		data:       map[string]string{"ca.crt": "ca", "ca.crl": "crl"},
+		want: &tlsV3.Secret{
+			Name: "cert",
+			Type: &tlsV3.Secret_ValidationContext{
+				ValidationContext: &tlsV3.CertificateValidationContext{
+					TrustedCa: inline("ca"),
+					Crl:       inline("crl"),
+				},
+			},
+		},
+	}, {
+		name:        "SDS name annotation",
+		secretType:  corev1.SecretTypeTLS,
+		annotations: map[string]string{SecretNameAnnotation: "ingress"},
+		data:        map[string]string{"tls.crt": "cert", "tls.key": "key"},
+		want:        certificate("ingress"),
+	}, {
+		name:        "type annotation overrides the keys",
+		secretType:  corev1.SecretTypeTLS,
+		annotations: map[string]string{SecretTypeAnnotation: "validation-context"},
+		data:        map[string]string{"tls.crt": "cert", "tls.key": "key", "ca.crt": "ca"},
+		want: &tlsV3.Secret{
+			Name: "cert",
+			Type: &tlsV3.Secret_ValidationContext{
+				ValidationContext: &tlsV3.CertificateValidationContext{TrustedCa: inline("ca")},
+			},
+		},
+	}, {
+		name:       "TLS secret without a key",
+		secretType: corev1.SecretTypeTLS,
+		data:       map[string]string{"tls.crt": "cert"},
+		wantErr:    `TLS certificate secret needs "tls.crt" and "tls.key" keys`,
+	}, {
+		name:       "TLS secret with an empty key",
+		secretType: corev1.SecretTypeTLS,
+		data:       map[string]string{"tls.crt": "cert", "tls.key": ""},
+		wantErr:    `TLS certificate secret needs "tls.crt" and "tls.key" keys`,
+	}, {
+		name:       "opaque secret without keys",
+		secretType: corev1.SecretTypeOpaque,
+		data:       map[string]string{"password": "secret"},
+		wantErr:    `secret has neither "tls.crt" and "tls.key" keys nor a "ca.crt" key`,
+	}, {
+		name:        "validation context without a CA",
+		secretType:  corev1.SecretTypeOpaque,
+		annotations: map[string]string{SecretTypeAnnotation: "validation-context"},
+		data:        map[string]string{"tls.crt": "cert", "tls.key": "key"},
+		wantErr:     `validation context secret needs a "ca.crt" key`,
+	}, {
+		name:        "invalid type annotation",
+		secretType:  corev1.SecretTypeTLS,
+		annotations: map[string]string{SecretTypeAnnotation: "password"},
+		data:        map[string]string{"tls.crt": "cert", "tls.key": "key"},
+		wantErr:     `invalid envoy.projectcontour.io/sds-type annotation "password"`,
+	}}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			s := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "cert",
+					Annotations: tc.annotations,
+				},
+				Type: tc.secretType,
+				Data: map[string][]byte{},
+			}
+
+			for k, v := range tc.data {
+				s.Data[k] = []byte(v)
+			}
+
+			got, err := TranslateSecret(s)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Truef(t, proto.Equal(tc.want, got), "got %v", got)
+		})
+	}
+}
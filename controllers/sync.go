@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// waitForCacheSync waits until the cache has synced the informers for
+// the given kinds of objects, creating any informers that the
+// controllers haven't started yet.
+func waitForCacheSync(ctx context.Context, c cache.Cache, objects ...runtime.Object) error {
+	for _, obj := range objects {
+		if _, err := c.GetInformer(ctx, obj); err != nil {
+			return fmt.Errorf("failed to get %T informer: %w", obj, err)
+		}
+	}
+
+	if !c.WaitForCacheSync(ctx.Done()) {
+		return errors.New("cache sync was stopped")
+	}
+
+	return nil
+}
+
+// WaitForCacheSync waits until the cache has synced every kind of
+// Envoy resource object.
+func (e *EnvoyReconciler) WaitForCacheSync(ctx context.Context, c cache.Cache) error {
+	objects := make([]runtime.Object, 0, len(factories))
+	for _, factory := range factories {
+		objects = append(objects, factory())
+	}
+
+	return waitForCacheSync(ctx, c, objects...)
+}
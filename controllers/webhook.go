@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/must"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	webhookconversion "sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+// ValidatingWebhookPath is the path that the validating admission
+// webhook is served on.
+const ValidatingWebhookPath = "/validate-envoy-projectcontour-io-v1alpha1"
+
+// ConversionWebhookPath is the path that the CRD conversion webhook
+// is served on.
+const ConversionWebhookPath = "/convert"
+
+// nolint(lll)
+// +kubebuilder:webhook:path=/validate-envoy-projectcontour-io-v1alpha1,mutating=false,failurePolicy=fail,groups=envoy.projectcontour.io,resources=clusterloadassignments;clusters;listeners;routeconfigurations;runtimes;scopedrouteconfigurations;secrets;virtualhosts,verbs=create;update,versions=v1alpha1;v1alpha2,name=validate.envoy.projectcontour.io
+
+// EnvoyValidator is a validating admission webhook that rejects
+// Envoy resources that the EnvoyReconciler would not accept. Other
+// API versions are converted to the version that the EnvoyReconciler
+// accepts before they are validated.
+type EnvoyValidator struct {
+	Scheme *runtime.Scheme
+
+	// NamingPolicy is applied to every resource. Only the
+	// NamingPolicyValidate policy can reject a resource.
+	NamingPolicy xds.NamingPolicy
+
+	decoder *admission.Decoder
+	kinds   map[schema.GroupKind]func() runtime.Object
+}
+
+var _ admission.Handler = &EnvoyValidator{}
+var _ admission.DecoderInjector = &EnvoyValidator{}
+
+// InjectDecoder injects the admission request decoder.
+func (v *EnvoyValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates the Envoy resource in the admission request
+// with AcceptResource.
+func (v *EnvoyValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// Deleting is always OK.
+	if req.Operation == admissionv1beta1.Delete {
+		return admission.Allowed("")
+	}
+
+	gvk := schema.GroupVersionKind{
+		Group:   req.Kind.Group,
+		Version: req.Kind.Version,
+		Kind:    req.Kind.Kind,
+	}
+
+	factory, ok := v.kinds[gvk.GroupKind()]
+	if !ok {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("unsupported resource kind %q", gvk))
+	}
+
+	o := factory()
+	hubGVK := must.GroupVersionKind(apiutil.GVKForObject(o, v.Scheme))
+
+	if gvk == hubGVK {
+		if err := v.decoder.Decode(req, o); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	} else {
+		spoke, err := v.Scheme.New(gvk)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, fmt.Errorf("unsupported resource kind %q", gvk))
+		}
+
+		if err := v.decoder.Decode(req, spoke); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		convertible, ok := spoke.(conversion.Convertible)
+		if !ok {
+			return admission.Errored(http.StatusInternalServerError,
+				fmt.Errorf("resource %T is not convertible", spoke))
+		}
+
+		if err := convertible.ConvertTo(o.(conversion.Hub)); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	obj, ok := o.(envoyv1alpha1.Object)
+	if !ok {
+		return admission.Errored(http.StatusInternalServerError,
+			fmt.Errorf("resource %T is not an Envoy object", o))
+	}
+
+	resource, err := AcceptResource(obj, hubGVK)
+	if err == nil {
+		err = ApplyNamingPolicy(v.NamingPolicy, obj, resource)
+	}
+
+	if err != nil {
+		return admission.Denied(fmt.Sprintf("%s: %s", err.Reason, err.Message))
+	}
+
+	return admission.Allowed("")
+}
+
+// SetupWebhookWithManager registers the validating webhook and the
+// CRD conversion webhook with the manager's webhook server. The
+// conversion webhook converts between the API versions in the
+// manager's scheme.
+func (v *EnvoyValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	v.registerKinds()
+
+	mgr.GetWebhookServer().Register(ValidatingWebhookPath, &webhook.Admission{Handler: v})
+	mgr.GetWebhookServer().Register(ConversionWebhookPath, &webhookconversion.Webhook{})
+
+	return nil
+}
+
+// registerKinds registers the kinds of Envoy resources that the
+// validator accepts. Each kind is accepted in every API version
+// that the scheme can convert to the version in the factory.
+func (v *EnvoyValidator) registerKinds() {
+	v.kinds = map[schema.GroupKind]func() runtime.Object{}
+
+	for _, factory := range factories {
+		gvk := must.GroupVersionKind(apiutil.GVKForObject(factory(), v.Scheme))
+		v.kinds[gvk.GroupKind()] = factory
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	envoyv1alpha2 "github.com/jpeach/envoy-controller/api/v1alpha2"
+	"github.com/jpeach/envoy-controller/pkg/kubernetes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidatorValidatesEveryVersion(t *testing.T) {
+	scheme := kubernetes.NewScheme()
+
+	decoder, err := admission.NewDecoder(scheme)
+	require.NoError(t, err)
+
+	v := &EnvoyValidator{Scheme: scheme}
+	require.NoError(t, v.InjectDecoder(decoder))
+	v.registerKinds()
+
+	request := func(obj runtime.Object, version string) admission.Request {
+		data, err := json.Marshal(obj)
+		require.NoError(t, err)
+
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: admissionv1beta1.Create,
+			Kind: metav1.GroupVersionKind{
+				Group:   envoyv1alpha1.GroupVersion.Group,
+				Version: version,
+				Kind:    "Cluster",
+			},
+			Object: runtime.RawExtension{Raw: data},
+		}}
+	}
+
+	cluster := func(spec string) *envoyv1alpha2.Cluster {
+		return &envoyv1alpha2.Cluster{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: envoyv1alpha2.GroupVersion.String(),
+				Kind:       "Cluster",
+			},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "one"},
+			Spec: envoyv1alpha2.ClusterSpec{
+				Cluster: runtime.RawExtension{Raw: []byte(spec)},
+			},
+		}
+	}
+
+	resp := v.Handle(context.Background(), request(cluster(
+		`{"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "one"}`,
+	), "v1alpha2"))
+	assert.True(t, resp.Allowed, resp.Result)
+
+	// A v1alpha2 object is validated after conversion.
+	resp = v.Handle(context.Background(), request(cluster(
+		`{"@type": "type.googleapis.com/envoy.config.listener.v3.Listener", "name": "one"}`,
+	), "v1alpha2"))
+	assert.False(t, resp.Allowed)
+	assert.Contains(t, string(resp.Result.Reason), "TypeAmbiguity")
+
+	// v1alpha1 objects are still validated.
+	hub := &envoyv1alpha1.Cluster{}
+	require.NoError(t, cluster(
+		`{"@type": "type.googleapis.com/envoy.config.listener.v3.Listener", "name": "one"}`,
+	).ConvertTo(hub))
+	hub.APIVersion = envoyv1alpha1.GroupVersion.String()
+	hub.Kind = "Cluster"
+
+	resp = v.Handle(context.Background(), request(hub, "v1alpha1"))
+	assert.False(t, resp.Allowed)
+	assert.Contains(t, string(resp.Result.Reason), "TypeAmbiguity")
+}
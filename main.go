@@ -66,6 +66,10 @@ func main() {
 
 	root.AddCommand(cli.Defaults(cli.NewRunCommand()))
 	root.AddCommand(cli.Defaults(cli.NewCreateCommand()))
+	root.AddCommand(cli.Defaults(cli.NewGetCommand()))
+	root.AddCommand(cli.Defaults(cli.NewApplyCommand()))
+	root.AddCommand(cli.Defaults(cli.NewDiffCommand()))
+	root.AddCommand(cli.Defaults(cli.NewValidateCommand()))
 	root.AddCommand(cli.Defaults(cli.NewBootstrapCommand()))
 
 	if err := root.Execute(); err != nil {
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/kubernetes"
+	"github.com/jpeach/envoy-controller/pkg/must"
+	"github.com/jpeach/envoy-controller/pkg/version"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewApplyCommand ...
+func NewApplyCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "apply [OPTIONS]",
+		Short: "Apply Envoy resources from files, directories or stdin",
+		Long: `Apply Envoy resources from files, directories or stdin
+
+Each input document is an Envoy resource in the protobuf JSON (or YAML)
+format, with the resource type named by the "@type" field. Multiple
+documents are separated by "---" lines. The kind of each Kubernetes
+object is chosen from the resource type, and the object name is the
+Envoy resource name, lowercased, with any characters that are not valid
+in a Kubernetes name replaced by "-".
+
+Objects are updated with server-side apply.
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			encoding, err := messageEncoding(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			policy, err := namingPolicy(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			var docs []document
+
+			for _, fname := range must.StringSlice(cmd.Flags().GetStringSlice("filename")) {
+				d, err := readDocuments(fname)
+				if err != nil {
+					return &ExitError{EX_DATAERR, err}
+				}
+
+				docs = append(docs, d...)
+			}
+
+			if len(docs) == 0 {
+				return ExitErrorf(EX_NOINPUT, "no Envoy resources found")
+			}
+
+			namespace := NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace")))
+			nodes := must.StringSlice(cmd.Flags().GetStringSlice("node"))
+
+			var objects []runtime.Object
+
+			// Different Envoy names can map to the same object
+			// name, and then the later document would silently
+			// replace the earlier one.
+			seen := map[string]document{}
+
+			for _, d := range docs {
+				name, err := objectNameFor(xds.NameOf(d.Message))
+				if err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				if other, ok := seen[d.Kind+"/"+name]; ok {
+					return ExitErrorf(EX_DATAERR, "%s: Envoy %s %q has the same object name %q as %q in %s",
+						d.Source, d.Kind, xds.NameOf(d.Message), name, xds.NameOf(other.Message), other.Source)
+				}
+
+				seen[d.Kind+"/"+name] = d
+
+				if err := policy.Apply(d.Message, path.Join(namespace, name)); err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				message, err := newMessage(d.Message, encoding)
+				if err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				obj, err := newResource(d.Kind, metav1.ObjectMeta{Namespace: namespace, Name: name}, message, nodes)
+				if err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				objects = append(objects, obj)
+			}
+
+			c, err := kubernetes.NewClient()
+			if err != nil {
+				return &ExitError{EX_CONFIG, err}
+			}
+
+			opts := []client.PatchOption{
+				client.FieldOwner(must.String(cmd.Flags().GetString("field-manager"))),
+			}
+
+			if must.Bool(cmd.Flags().GetBool("force-conflicts")) {
+				opts = append(opts, client.ForceOwnership)
+			}
+
+			failed := false
+
+			for _, obj := range objects {
+				what := describeObject(obj.GetObjectKind().GroupVersionKind().Kind,
+					must.Object(meta.Accessor(obj)).GetName())
+
+				result, err := applyResource(c, obj, opts...)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s: %s\n", version.Progname, what, err)
+					failed = true
+					continue
+				}
+
+				fmt.Printf("%s %s\n", what, result)
+			}
+
+			if failed {
+				return &ExitError{Code: EX_FAIL}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("namespace", "n", "", "The namespace in which to apply the resources.")
+	cmd.Flags().StringSliceP("filename", "f", []string{"-"},
+		"File or directory containing the resources to apply (may be repeated).")
+	cmd.Flags().String("encoding", "binary", "Encode the Envoy resources as \"binary\" or \"json\".")
+	cmd.Flags().StringSlice("node", nil, "Envoy node cluster to publish the resources to (may be repeated).")
+	addNamingPolicyFlag(cmd.Flags())
+	cmd.Flags().String("field-manager", version.Progname, "The name of the server-side apply field manager.")
+	cmd.Flags().Bool("force-conflicts", false, "Take ownership of fields that conflict with other managers.")
+
+	return &cmd
+}
+
+// applyResource applies the object with server-side apply, and
+// returns whether the object was "created", "configured" or
+// "unchanged".
+func applyResource(c client.Client, obj runtime.Object, opts ...client.PatchOption) (string, error) {
+	ctx := context.Background()
+	m := must.Object(meta.Accessor(obj))
+
+	existing, err := kubernetes.NewScheme().New(obj.GetObjectKind().GroupVersionKind())
+	if err != nil {
+		return "", err
+	}
+
+	previousVersion := ""
+
+	switch err := c.Get(ctx, types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}, existing); {
+	case err == nil:
+		previousVersion = must.Object(meta.Accessor(existing)).GetResourceVersion()
+	case apierrors.IsNotFound(err):
+	default:
+		return "", err
+	}
+
+	if err := c.Patch(ctx, obj, client.Apply, opts...); err != nil {
+		return "", err
+	}
+
+	switch {
+	case previousVersion == "":
+		return "created", nil
+	case previousVersion == m.GetResourceVersion():
+		return "unchanged", nil
+	default:
+		return "configured", nil
+	}
+}
+
+// describeObject returns a kubectl-style description of the named
+// object of the given kind.
+func describeObject(kind string, name string) string {
+	return fmt.Sprintf("%s.%s/%s", strings.ToLower(kind), envoyv1alpha1.GroupVersion.Group, name)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// objectNameFor returns the Kubernetes object name for the given
+// Envoy resource name.
+func objectNameFor(envoyName string) (string, error) {
+	if envoyName == "" {
+		return "", errors.New("resource has no Envoy name")
+	}
+
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(envoyName), "-"), "-.")
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid Kubernetes name for Envoy name %q: %s",
+			envoyName, strings.Join(errs, ", "))
+	}
+
+	return name, nil
+}
@@ -55,8 +55,8 @@ func NewBootstrapCommand() *cobra.Command {
 			}
 
 			opts := []bootstrap.Option{
-				bootstrap.NodeCluster(must.String(os.Hostname())),
-				bootstrap.NodeID(must.String(os.Hostname())),
+				bootstrap.NodeCluster(must.String(cmd.Flags().GetString("node-cluster"))),
+				bootstrap.NodeID(must.String(cmd.Flags().GetString("node-id"))),
 				bootstrap.ResourceVersion(vers),
 				bootstrap.ManagementClusterName(must.String(cmd.Flags().GetString("xds-clustername"))),
 				bootstrap.ManagementAddress(xdsAddr),
@@ -86,6 +86,8 @@ func NewBootstrapCommand() *cobra.Command {
 
 	cmd.Flags().String("admin-address", ":8080", "The address the Envoy admin endpoint binds to.")
 	cmd.Flags().String("admin-accesslog", "/dev/null", "Path for the Envoy admin endpoint access log.")
+	cmd.Flags().String("node-cluster", must.String(os.Hostname()), "The Envoy node cluster (selects published resources).")
+	cmd.Flags().String("node-id", must.String(os.Hostname()), "The Envoy node ID.")
 	cmd.Flags().String("xds-address", "/var/run/xds.sock", "The address the xDS endpoint binds to.")
 	cmd.Flags().String("xds-clustername", "envoy-controller", "The name to use for the xDS management cluster.")
 	cmd.Flags().Bool("xds-incremental", false, "Enable the incremental (delta) xDS protocol.")
@@ -2,9 +2,11 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 
 	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
@@ -15,7 +17,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -46,8 +48,18 @@ func NamespaceOrDefault(ns string) string {
 // NewCreateCommand ...
 func NewCreateCommand() *cobra.Command {
 	cmd := cobra.Command{
-		Use:   "create RESOURCE NAME [OPTIONS]",
+		Use:   "create [RESOURCE] NAME [OPTIONS]",
 		Short: "Create an Envoy resource from a file or stdin",
+		Long: `Create an Envoy resource from a file or stdin
+
+If the resource kind is not given, it is inferred from the "@type" field
+of the Envoy resource, and the Envoy API version is inferred from the
+type too.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCreate(cmd, "", args[0])
+		},
 	}
 
 	for _, k := range xds.Kinds() {
@@ -57,43 +69,7 @@ func NewCreateCommand() *cobra.Command {
 			Short: fmt.Sprintf("Create an Envoy %s resource from a file or stdin", k),
 			Args:  cobra.ExactArgs(1),
 			RunE: func(cmd *cobra.Command, args []string) error {
-				name := types.NamespacedName{
-					Namespace: NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace"))),
-					Name:      args[0],
-				}
-
-				var input []byte
-				var err error
-
-				if must.Bool(cmd.Flags().GetBool("2")) && must.Bool(cmd.Flags().GetBool("3")) {
-					return ExitErrorf(EX_USAGE, "multiple Envoy API versions specified")
-				}
-
-				mtype, err := xds.ProtobufForKind(envoyVersion(cmd.Flags()), k)
-				if err != nil {
-					return &ExitError{EX_CONFIG, err}
-				}
-
-				if fname := must.String(cmd.Flags().GetString("filename")); fname != "-" {
-					input, err = ioutil.ReadFile(fname) // nolint(gosec)
-				} else {
-					input, err = ioutil.ReadAll(os.Stdin)
-				}
-
-				if err != nil {
-					return &ExitError{Code: EX_DATAERR, Err: err}
-				}
-
-				obj, err := createResourceV3(k, name, input, mtype)
-				if err != nil {
-					return &ExitError{Code: EX_FAIL, Err: err}
-				}
-
-				if must.String(cmd.Flags().GetString("output")) != "" {
-					return formatResource(obj, must.String(cmd.Flags().GetString("output")))
-				}
-
-				return createResource(obj)
+				return runCreate(cmd, k, args[0])
 			},
 		}
 
@@ -103,12 +79,158 @@ func NewCreateCommand() *cobra.Command {
 	cmd.PersistentFlags().StringP("namespace", "n", "", "The namespace in which to create the resource.")
 	cmd.PersistentFlags().StringP("filename", "f", "-", "Filename used to create the resource.")
 	cmd.PersistentFlags().StringP("output", "o", "", "Output the object as YAML or JSON instead of creating it.")
-	cmd.PersistentFlags().BoolP("3", "3", false, "Create the object for the Envoy v2 API.")
-	cmd.PersistentFlags().BoolP("2", "2", false, "Create the object for the Envoy v3 API.")
+	cmd.PersistentFlags().String("encoding", "binary", "Encode the Envoy resource as \"binary\" or \"json\".")
+	cmd.PersistentFlags().StringSlice("node", nil, "Envoy node cluster to publish the resource to (may be repeated).")
+	addNamingPolicyFlag(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolP("3", "3", false, "Create the object for the Envoy v3 API.")
+	cmd.PersistentFlags().BoolP("2", "2", false, "Create the object for the Envoy v2 API.")
 
 	return &cmd
 }
 
+// runCreate creates the named resource of the given kind. If kind is
+// empty, it is inferred from the type of the input message.
+func runCreate(cmd *cobra.Command, kind string, objectName string) error {
+	name := types.NamespacedName{
+		Namespace: NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace"))),
+		Name:      objectName,
+	}
+
+	var input []byte
+	var err error
+
+	if must.Bool(cmd.Flags().GetBool("2")) && must.Bool(cmd.Flags().GetBool("3")) {
+		return ExitErrorf(EX_USAGE, "multiple Envoy API versions specified")
+	}
+
+	if fname := must.String(cmd.Flags().GetString("filename")); fname != "-" {
+		input, err = ioutil.ReadFile(fname) // nolint(gosec)
+	} else {
+		input, err = ioutil.ReadAll(os.Stdin)
+	}
+
+	if err != nil {
+		return &ExitError{Code: EX_DATAERR, Err: err}
+	}
+
+	var protoMessage proto.Message
+
+	if kind == "" {
+		kind, protoMessage, err = inferMessage(cmd.Flags(), input)
+		if err != nil {
+			return err
+		}
+	} else {
+		mtype, err := xds.ProtobufForKind(envoyVersion(cmd.Flags()), kind)
+		if err != nil {
+			return &ExitError{EX_CONFIG, err}
+		}
+
+		// Unmarshal the JSON into an instance of the message type.
+		protoMessage = mtype.New().Interface()
+		if err := protojson.Unmarshal(input, protoMessage); err != nil {
+			return &ExitError{Code: EX_FAIL, Err: err}
+		}
+	}
+
+	policy, err := namingPolicy(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Apply(protoMessage, path.Join(name.Namespace, name.Name)); err != nil {
+		return &ExitError{Code: EX_DATAERR, Err: err}
+	}
+
+	nodes := must.StringSlice(cmd.Flags().GetStringSlice("node"))
+
+	encoding, err := messageEncoding(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	obj, err := createResourceV3(kind, name, nodes, encoding, protoMessage)
+	if err != nil {
+		return &ExitError{Code: EX_FAIL, Err: err}
+	}
+
+	if must.String(cmd.Flags().GetString("output")) != "" {
+		return formatResource(obj, must.String(cmd.Flags().GetString("output")))
+	}
+
+	return createResource(obj)
+}
+
+// inferMessage unmarshals a protobuf JSON message that names its type
+// in the "@type" field, and returns the resource kind for the type.
+// If an Envoy API version flag was given, the type must belong to
+// that version.
+func inferMessage(flags *pflag.FlagSet, input []byte) (string, proto.Message, error) {
+	var probe struct {
+		Type string `json:"@type"`
+	}
+
+	if err := json.Unmarshal(input, &probe); err != nil {
+		return "", nil, &ExitError{Code: EX_DATAERR, Err: err}
+	}
+
+	if probe.Type == "" {
+		return "", nil, ExitErrorf(EX_USAGE,
+			"ambiguous Envoy resource: no \"@type\" field, so the resource kind must be given")
+	}
+
+	kind := xds.KindForTypename(probe.Type)
+	if kind == "" {
+		return "", nil, ExitErrorf(EX_USAGE, "unknown Envoy resource type %q", probe.Type)
+	}
+
+	protoMessage, err := xds.UnmarshalJSON(input)
+	if err != nil {
+		return "", nil, &ExitError{Code: EX_DATAERR, Err: err}
+	}
+
+	vers := xds.VersionForMessage(protoMessage.ProtoReflect().Descriptor())
+
+	for _, want := range []xds.EnvoyVersion{xds.EnvoyVersion2, xds.EnvoyVersion3} {
+		if must.Bool(flags.GetBool(strings.TrimPrefix(string(want), "v"))) && vers != want {
+			return "", nil, ExitErrorf(EX_USAGE, "Envoy resource type %q is not an Envoy %s type", probe.Type, want)
+		}
+	}
+
+	return kind, protoMessage, nil
+}
+
+// addNamingPolicyFlag adds the "naming-policy" flag to flags.
+func addNamingPolicyFlag(flags *pflag.FlagSet) {
+	flags.String("naming-policy", string(xds.NamingPolicyKeep),
+		fmt.Sprintf("How Envoy resource names relate to Kubernetes object names (%s).",
+			strings.Join(xds.NamingPolicies(), "|")))
+}
+
+// namingPolicy returns the NamingPolicy selected by the
+// "naming-policy" flag.
+func namingPolicy(flags *pflag.FlagSet) (xds.NamingPolicy, error) {
+	policy, err := xds.ParseNamingPolicy(must.String(flags.GetString("naming-policy")))
+	if err != nil {
+		return "", &ExitError{Code: EX_USAGE, Err: err}
+	}
+
+	return policy, nil
+}
+
+// messageEncoding returns the Message encoding selected by the
+// "encoding" flag.
+func messageEncoding(flags *pflag.FlagSet) (string, error) {
+	switch e := must.String(flags.GetString("encoding")); e {
+	case "binary":
+		return envoyv1alpha1.MessageEncodingBinary, nil
+	case "json":
+		return envoyv1alpha1.MessageEncodingJSON, nil
+	default:
+		return "", ExitErrorf(EX_USAGE, "unsupported message encoding %q", e)
+	}
+}
+
 func createResource(obj runtime.Object) error {
 	client, err := kubernetes.NewClient()
 	if err != nil {
@@ -136,80 +258,112 @@ func formatResource(obj runtime.Object, format string) error {
 }
 
 func createResourceV3(
-	kind string, name types.NamespacedName, in []byte, mtype protoreflect.MessageType) (runtime.Object, error) {
-	// Unmarshal the JSON into an instance of the message type.
-	protoMessage := mtype.New().Interface()
-	if err := protojson.Unmarshal(in, protoMessage); err != nil {
-		return nil, err
+	kind string,
+	name types.NamespacedName,
+	nodes []string,
+	encoding string,
+	protoMessage proto.Message,
+) (runtime.Object, error) {
+	objectMeta := metav1.ObjectMeta{
+		Name:              name.Name,
+		Namespace:         name.Namespace,
+		CreationTimestamp: metav1.Now(),
 	}
 
-	//  TODO(jpeach): if the protobuf object has a "name" field,
-	// force it to match the fully qualified Kubernetes resource
-	// name.
-
-	// Marshal the Any message payload.
-	anyMessage, err := xds.MarshalAny(protoMessage)
+	message, err := newMessage(protoMessage, encoding)
 	if err != nil {
 		return nil, err
 	}
 
-	objectMeta := metav1.ObjectMeta{
-		Name:              name.Name,
-		Namespace:         name.Namespace,
-		CreationTimestamp: metav1.Now(),
-	}
+	return newResource(kind, objectMeta, message, nodes)
+}
 
-	message := envoyv1alpha1.Message{
-		Type:  anyMessage.GetTypeUrl(),
-		Value: anyMessage.GetValue(),
+// newMessage encodes the protobuf message as a Message.
+func newMessage(protoMessage proto.Message, encoding string) (envoyv1alpha1.Message, error) {
+	var message envoyv1alpha1.Message
+
+	switch encoding {
+	case envoyv1alpha1.MessageEncodingJSON:
+		data, err := xds.MarshalJSON(protoMessage)
+		if err != nil {
+			return message, err
+		}
+
+		message.JSON = &runtime.RawExtension{Raw: data}
+	default:
+		// Marshal the Any message payload.
+		anyMessage, err := xds.MarshalAny(protoMessage)
+		if err != nil {
+			return message, err
+		}
+
+		message.Type = anyMessage.GetTypeUrl()
+		message.Value = anyMessage.GetValue()
 	}
 
+	return message, nil
+}
+
+// newResource returns a new Envoy resource object of the given kind.
+func newResource(
+	kind string,
+	objectMeta metav1.ObjectMeta,
+	message envoyv1alpha1.Message,
+	nodes []string,
+) (runtime.Object, error) {
 	var obj runtime.Object
 
 	switch kind {
 	case "Listener":
 		obj = &envoyv1alpha1.Listener{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.ListenerSpec{Listener: message},
+			Spec:       envoyv1alpha1.ListenerSpec{Listener: message, Nodes: nodes},
 		}
 
 	case "Cluster":
 		obj = &envoyv1alpha1.Cluster{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.ClusterSpec{Cluster: message},
+			Spec:       envoyv1alpha1.ClusterSpec{Cluster: message, Nodes: nodes},
 		}
+
+	case "ClusterLoadAssignment":
+		obj = &envoyv1alpha1.ClusterLoadAssignment{
+			ObjectMeta: objectMeta,
+			Spec:       envoyv1alpha1.ClusterLoadAssignmentSpec{ClusterLoadAssignment: message, Nodes: nodes},
+		}
+
 	case "RouteConfiguration":
 		obj = &envoyv1alpha1.RouteConfiguration{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.RouteConfigurationSpec{RouteConfiguration: message},
+			Spec:       envoyv1alpha1.RouteConfigurationSpec{RouteConfiguration: message, Nodes: nodes},
 		}
 
 	case "ScopedRouteConfiguration":
 		obj = &envoyv1alpha1.ScopedRouteConfiguration{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.ScopedRouteConfigurationSpec{ScopedRouteConfiguration: message},
+			Spec:       envoyv1alpha1.ScopedRouteConfigurationSpec{ScopedRouteConfiguration: message, Nodes: nodes},
 		}
 
 	case "Secret":
 		obj = &envoyv1alpha1.Secret{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.SecretSpec{Secret: message},
+			Spec:       envoyv1alpha1.SecretSpec{Secret: message, Nodes: nodes},
 		}
 
 	case "Runtime":
 		obj = &envoyv1alpha1.Runtime{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.RuntimeSpec{Runtime: message},
+			Spec:       envoyv1alpha1.RuntimeSpec{Runtime: message, Nodes: nodes},
 		}
 
 	case "VirtualHost":
 		obj = &envoyv1alpha1.VirtualHost{
 			ObjectMeta: objectMeta,
-			Spec:       envoyv1alpha1.VirtualHostSpec{VirtualHost: message},
+			Spec:       envoyv1alpha1.VirtualHostSpec{VirtualHost: message, Nodes: nodes},
 		}
 
 	default:
-		panic(fmt.Sprintf("invalid kind %q", kind))
+		return nil, fmt.Errorf("invalid kind %q", kind)
 	}
 
 	// YAML output requires us to set the GVK explicitly.
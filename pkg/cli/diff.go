@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/kubernetes"
+	"github.com/jpeach/envoy-controller/pkg/must"
+	"github.com/jpeach/envoy-controller/pkg/version"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NewDiffCommand ...
+func NewDiffCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "diff [OPTIONS]",
+		Short: "Show the differences between local and live Envoy resources",
+		Long: `Show the differences between local and live Envoy resources
+
+Local Envoy resources are read in the same way as the apply command, and
+compared field by field with the Envoy resources stored in the cluster.
+Each difference is shown as an added ("+"), removed ("-") or changed
+("~") protobuf field. Resources that don't exist in the cluster are
+shown as a single addition.
+
+The exit status is 0 if there are no differences, and 1 if there are
+differences or an error occurred.
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var docs []document
+
+			for _, fname := range must.StringSlice(cmd.Flags().GetStringSlice("filename")) {
+				d, err := readDocuments(fname)
+				if err != nil {
+					return &ExitError{EX_DATAERR, err}
+				}
+
+				docs = append(docs, d...)
+			}
+
+			if len(docs) == 0 {
+				return ExitErrorf(EX_NOINPUT, "no Envoy resources found")
+			}
+
+			namespace := NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace")))
+
+			policy, err := namingPolicy(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			c, err := kubernetes.NewClient()
+			if err != nil {
+				return &ExitError{EX_CONFIG, err}
+			}
+
+			changed := false
+
+			for _, d := range docs {
+				name, err := objectNameFor(xds.NameOf(d.Message))
+				if err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				what := describeObject(d.Kind, name)
+
+				// Apply the naming policy that the resource was applied with.
+				if err := policy.Apply(d.Message, path.Join(namespace, name)); err != nil {
+					return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+				}
+
+				obj, err := getResource(c, d.Kind, types.NamespacedName{Namespace: namespace, Name: name})
+				switch {
+				case err == nil:
+				case apierrors.IsNotFound(err):
+					// The whole resource is new.
+					data, err := xds.MarshalJSON(d.Message)
+					if err != nil {
+						return ExitErrorf(EX_DATAERR, "%s: %w", d.Source, err)
+					}
+
+					fmt.Printf("--- %s\n+ %s\n", what, data)
+					changed = true
+					continue
+				default:
+					return ExitErrorf(EX_FAIL, "%s: %w", what, err)
+				}
+
+				live, err := kubernetes.DecodeMessage(obj.(envoyv1alpha1.Object).GetSpecMessage())
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s: failed to decode live resource: %s\n",
+						version.Progname, what, err)
+					changed = true
+					continue
+				}
+
+				diffs := xds.Diff(live, d.Message)
+				if len(diffs) == 0 {
+					continue
+				}
+
+				fmt.Printf("--- %s\n", what)
+
+				for _, diff := range diffs {
+					fmt.Println(diff)
+				}
+
+				changed = true
+			}
+
+			if changed {
+				return &ExitError{Code: EX_FAIL}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("namespace", "n", "", "The namespace of the live resources.")
+	cmd.Flags().StringSliceP("filename", "f", []string{"-"},
+		"File or directory containing the resources to compare (may be repeated).")
+	addNamingPolicyFlag(cmd.Flags())
+
+	return &cmd
+}
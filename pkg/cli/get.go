@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/kubernetes"
+	"github.com/jpeach/envoy-controller/pkg/must"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// decodedCondition is the subset of a status condition that we show
+// alongside a decoded resource.
+type decodedCondition struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// decodedResource is an Envoy resource whose message has been decoded
+// to the protobuf JSON format.
+type decodedResource struct {
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Accepted  *decodedCondition `json:"accepted,omitempty"`
+	Message   json.RawMessage   `json:"message,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// decodedList is the JSON form of a list of decoded resources, which
+// is a "List" object in the same style as kubectl.
+type decodedList struct {
+	Kind  string             `json:"kind"`
+	Items []*decodedResource `json:"items"`
+}
+
+// NewGetCommand ...
+func NewGetCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "get RESOURCE [NAME] [OPTIONS]",
+		Short: "Show Envoy resources decoded to the protobuf JSON format",
+	}
+
+	for _, k := range xds.Kinds() {
+		k := k
+		kindCmd := &cobra.Command{
+			Use:   fmt.Sprintf("%s [NAME] [OPTIONS]", strings.ToLower(k)),
+			Short: fmt.Sprintf("Show Envoy %s resources", k),
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				format := must.String(cmd.Flags().GetString("output"))
+				if format != "yaml" && format != "json" {
+					return ExitErrorf(EX_USAGE, "unsupported output format %q", format)
+				}
+
+				namespace := NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace")))
+				if must.Bool(cmd.Flags().GetBool("all-namespaces")) {
+					if len(args) > 0 {
+						return ExitErrorf(EX_USAGE, "a resource name can't be used with --all-namespaces")
+					}
+
+					namespace = ""
+				}
+
+				c, err := kubernetes.NewClient()
+				if err != nil {
+					return &ExitError{EX_CONFIG, err}
+				}
+
+				if len(args) > 0 {
+					obj, err := getResource(c, k, types.NamespacedName{Namespace: namespace, Name: args[0]})
+					if err != nil {
+						return &ExitError{EX_FAIL, err}
+					}
+
+					if err := printDecodedResource(os.Stdout, format, decodeResource(k, obj)); err != nil {
+						return &ExitError{EX_FAIL, err}
+					}
+
+					return nil
+				}
+
+				objects, err := listResources(c, k, namespace)
+				if err != nil {
+					return &ExitError{EX_FAIL, err}
+				}
+
+				decoded := make([]*decodedResource, 0, len(objects))
+				for _, obj := range objects {
+					decoded = append(decoded, decodeResource(k, obj))
+				}
+
+				if err := printDecodedResources(os.Stdout, format, decoded); err != nil {
+					return &ExitError{EX_FAIL, err}
+				}
+
+				return nil
+			},
+		}
+
+		cmd.AddCommand(Defaults(kindCmd))
+	}
+
+	cmd.PersistentFlags().StringP("namespace", "n", "", "The namespace of the resources.")
+	cmd.PersistentFlags().BoolP("all-namespaces", "A", false, "Show resources in all namespaces.")
+	cmd.PersistentFlags().StringP("output", "o", "yaml", "Output the resources as YAML or JSON.")
+
+	return &cmd
+}
+
+func getResource(c client.Client, kind string, name types.NamespacedName) (runtime.Object, error) {
+	obj, err := kubernetes.NewScheme().New(envoyv1alpha1.GroupVersion.WithKind(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Get(context.Background(), name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func listResources(c client.Client, kind string, namespace string) ([]runtime.Object, error) {
+	list, err := kubernetes.NewScheme().New(envoyv1alpha1.GroupVersion.WithKind(kind + "List"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.List(context.Background(), list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	return meta.ExtractList(list)
+}
+
+// decodeResource decodes the message of the given Envoy resource. If
+// the message can't be decoded, the returned resource holds the error.
+func decodeResource(kind string, obj runtime.Object) *decodedResource {
+	m := must.Object(meta.Accessor(obj))
+	d := &decodedResource{
+		Kind:      kind,
+		Namespace: m.GetNamespace(),
+		Name:      m.GetName(),
+	}
+
+	o, ok := obj.(envoyv1alpha1.Object)
+	if !ok {
+		d.Error = fmt.Sprintf("resource %T is not an Envoy object", obj)
+		return d
+	}
+
+	for _, c := range o.GetStatusConditions() {
+		if c.Type == "Accepted" {
+			d.Accepted = &decodedCondition{
+				Status:  string(c.Status),
+				Reason:  c.Reason,
+				Message: c.Message,
+			}
+		}
+	}
+
+	message, err := kubernetes.DecodeMessage(o.GetSpecMessage())
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+
+	data, err := xds.MarshalJSON(message)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+
+	d.Message = data
+
+	return d
+}
+
+// printDecodedResource prints a decoded resource as a YAML document
+// or a JSON object.
+func printDecodedResource(out io.Writer, format string, d *decodedResource) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == "yaml" {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+
+		_, err = out.Write(data)
+
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+
+	return err
+}
+
+// printDecodedResources prints a list of decoded resources as a stream
+// of YAML documents, or as a single JSON List object, so that the JSON
+// output is always one valid JSON document.
+func printDecodedResources(out io.Writer, format string, resources []*decodedResource) error {
+	if format == "yaml" {
+		for i, d := range resources {
+			if i > 0 {
+				fmt.Fprintln(out, "---")
+			}
+
+			if err := printDecodedResource(out, format, d); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	data, err := json.MarshalIndent(decodedList{Kind: "List", Items: resources}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+
+	return err
+}
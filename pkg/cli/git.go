@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+)
+
+// gitSource feeds the Envoy resources at a path in a Git repository
+// to the xDS server. The repository is polled for new commits, and
+// the resources in each new commit are published as a single
+// snapshot whose version is the commit SHA.
+type gitSource struct {
+	resourceLoader
+
+	// Repository is the path or URL of the Git repository.
+	Repository string
+	// Ref is the branch (or other ref) to follow.
+	Ref string
+	// Path is the file or directory in the repository that
+	// holds the resources.
+	Path string
+	// Interval is how often the repository is polled.
+	Interval time.Duration
+
+	Server *xds.Server
+
+	// mirror is a private bare clone of the repository.
+	mirror string
+	// commit is the SHA of the most recently loaded commit.
+	commit string
+}
+
+// git runs a git command in the mirror, and returns its output.
+func (g *gitSource) git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"--git-dir", g.mirror}, args...)...) // nolint(gosec)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// Poll fetches the repository and loads the resources from the
+// commit at the ref, if it has changed since the last poll.
+func (g *gitSource) Poll() error {
+	if _, err := g.git("fetch", "--quiet", "--prune", "origin"); err != nil {
+		return err
+	}
+
+	out, err := g.git("rev-parse", "--verify", "--quiet", g.Ref+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", g.Ref, err)
+	}
+
+	commit := strings.TrimSpace(string(out))
+	if commit == g.commit {
+		return nil
+	}
+
+	archive, err := g.git("archive", "--format=tar", commit, "--", g.Path)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "envoy-git-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(dir) // nolint(errcheck)
+
+	if err := extractTar(dir, bytes.NewReader(archive)); err != nil {
+		return fmt.Errorf("failed to extract commit %s: %w", commit, err)
+	}
+
+	g.Log.Info("loading commit", "commit", commit, "ref", g.Ref)
+
+	// Publish the whole commit at once, so that Envoy never
+	// sees a mix of resources from different commits.
+	err = g.Server.Batch(commit, func() error {
+		return g.Load(filepath.Join(dir, g.Path), commit, dir+string(filepath.Separator))
+	})
+
+	// The commit is loaded even if the status file can't be written.
+	g.commit = commit
+
+	return err
+}
+
+// Start clones the repository and loads the resources from the ref,
+// then polls for new commits until the stop channel is closed.
+func (g *gitSource) Start(stop <-chan struct{}) error {
+	mirror, err := ioutil.TempDir("", "envoy-git-mirror-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(mirror) // nolint(errcheck)
+
+	// Clone a private mirror, so that we never touch the
+	// working tree of a local repository.
+	g.mirror = filepath.Join(mirror, "repo.git")
+
+	clone := exec.Command("git", "clone", "--quiet", "--mirror", g.Repository, g.mirror) // nolint(gosec)
+	if out, err := clone.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone %q: %w: %s", g.Repository, err, strings.TrimSpace(string(out)))
+	}
+
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Poll(); err != nil {
+			g.Log.Error(err, "failed to poll repository", "repository", g.Repository)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// extractTar extracts the regular files and directories in the tar
+// stream into dir. Other entries, such as symlinks, are skipped.
+func extractTar(dir string, in io.Reader) error {
+	reader := tar.NewReader(in)
+
+	for {
+		hdr, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("invalid archive path %q", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0750); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(f, reader); err != nil { // nolint(gosec)
+				f.Close() // nolint(errcheck)
+				return err
+			}
+
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
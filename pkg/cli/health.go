@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// newHealthServer returns an HTTP server that serves liveness checks
+// on "/healthz" and readiness checks on "/readyz". The controller is
+// ready once the xDS server has synced its resources and is publishing
+// snapshots to Envoy.
+func newHealthServer(address string, xdsServer *xds.Server) *http.Server {
+	synced := func(*http.Request) error {
+		if !xdsServer.Synced() {
+			return errors.New("waiting for the resource source to sync")
+		}
+
+		return nil
+	}
+
+	mux := http.NewServeMux()
+
+	for path, checks := range map[string]map[string]healthz.Checker{
+		"/healthz": {"ping": healthz.Ping},
+		"/readyz":  {"synced": synced},
+	} {
+		handler := http.StripPrefix(path, &healthz.Handler{Checks: checks})
+		mux.Handle(path, handler)
+		mux.Handle(path+"/", handler)
+	}
+
+	return &http.Server{Addr: address, Handler: mux}
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"google.golang.org/protobuf/proto"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// rawDocument is a single JSON document read from an input file.
+// YAML documents are converted to JSON.
+type rawDocument struct {
+	Source string
+	Data   []byte
+}
+
+// document is a single Envoy resource document read from an input file.
+type document struct {
+	Source  string
+	Kind    string
+	Message proto.Message
+}
+
+// readDocuments reads Envoy resource documents from the named file,
+// from every JSON and YAML file in the named directory, or from
+// stdin if the name is "-".
+func readDocuments(fname string) ([]document, error) {
+	raw, err := readRawDocuments(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]document, 0, len(raw))
+
+	for _, r := range raw {
+		d, err := decodeDocument(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Source, err)
+		}
+
+		docs = append(docs, d)
+	}
+
+	return docs, nil
+}
+
+// decodeDocument decodes an Envoy resource document, choosing the
+// resource kind from its type.
+func decodeDocument(raw rawDocument) (document, error) {
+	message, err := xds.UnmarshalJSON(raw.Data)
+	if err != nil {
+		return document{}, err
+	}
+
+	kind := xds.KindForTypename(xds.TypeURL(message))
+	if kind == "" {
+		return document{}, fmt.Errorf("unsupported Envoy resource type %q", xds.TypeURL(message))
+	}
+
+	return document{Source: raw.Source, Kind: kind, Message: message}, nil
+}
+
+// inputFile is the documents read from a single input file, or the
+// error that prevented them from being read.
+type inputFile struct {
+	Source    string
+	Documents []rawDocument
+	Err       error
+}
+
+// readRawDocuments reads JSON or YAML documents from the named file,
+// from every JSON and YAML file in the named directory, or from
+// stdin if the name is "-".
+func readRawDocuments(fname string) ([]rawDocument, error) {
+	var docs []rawDocument
+
+	for _, f := range readInputFiles(fname) {
+		if f.Err != nil {
+			return nil, f.Err
+		}
+
+		docs = append(docs, f.Documents...)
+	}
+
+	return docs, nil
+}
+
+// readInputFiles reads JSON or YAML documents in the same way as
+// readRawDocuments, but returns the documents of each file separately.
+// A file that can't be read or parsed doesn't stop the remaining files
+// in a directory from being read.
+func readInputFiles(fname string) []inputFile {
+	if fname == "-" {
+		docs, err := splitDocuments("<stdin>", os.Stdin)
+		return []inputFile{{Source: "<stdin>", Documents: docs, Err: err}}
+	}
+
+	info, err := os.Stat(fname)
+	if err != nil {
+		return []inputFile{{Source: fname, Err: err}}
+	}
+
+	if !info.IsDir() {
+		docs, err := readFileDocuments(fname)
+		return []inputFile{{Source: fname, Documents: docs, Err: err}}
+	}
+
+	entries, err := ioutil.ReadDir(fname)
+	if err != nil {
+		return []inputFile{{Source: fname, Err: err}}
+	}
+
+	var files []inputFile
+
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+
+		if e.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(fname, e.Name())
+		docs, err := readFileDocuments(path)
+		files = append(files, inputFile{Source: path, Documents: docs, Err: err})
+	}
+
+	return files
+}
+
+func readFileDocuments(fname string) ([]rawDocument, error) {
+	f, err := os.Open(fname) // nolint(gosec)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() // nolint(errcheck)
+
+	return splitDocuments(fname, f)
+}
+
+// splitDocuments splits a stream of "---" separated JSON or YAML
+// documents. Empty documents are skipped.
+func splitDocuments(source string, in io.Reader) ([]rawDocument, error) {
+	var docs []rawDocument
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+
+	for i := 1; ; i++ {
+		data, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+
+		where := fmt.Sprintf("%s: document %d", source, i)
+
+		data, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+
+		if data = bytes.TrimSpace(data); len(data) == 0 || bytes.Equal(data, []byte("null")) {
+			continue
+		}
+
+		docs = append(docs, rawDocument{Source: where, Data: data})
+	}
+}
@@ -1,6 +1,14 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"github.com/jpeach/envoy-controller/controllers"
 	"github.com/jpeach/envoy-controller/pkg/kubernetes"
 	"github.com/jpeach/envoy-controller/pkg/must"
@@ -9,7 +17,11 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // NewRunCommand returns a command that runs the controller.
@@ -25,27 +37,111 @@ func NewRunCommand() *cobra.Command {
 					must.String(cmd.Flags().GetString("xds-address")), err)
 			}
 
-			mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-				Scheme:             kubernetes.NewScheme(),
-				MetricsBindAddress: must.String(cmd.Flags().GetString("metrics-address")),
-				LeaderElection:     must.Bool(cmd.Flags().GetBool("enable-leader-election")),
-				LeaderElectionID:   "06187118.projectcontour.io",
-			})
+			xdsServer := xds.NewServer(grpc.MaxConcurrentStreams(1 << 20))
+
+			if err := xdsServer.HoldUnresolved(must.StringSlice(cmd.Flags().GetStringSlice("hold-unresolved"))...); err != nil {
+				return ExitErrorf(EX_USAGE, "invalid --hold-unresolved: %w", err)
+			}
+
+			policy, err := xds.ParseNamingPolicy(must.String(cmd.Flags().GetString("naming-policy")))
 			if err != nil {
-				return ExitErrorf(EX_FAIL, "unable to start manager: %w", err)
+				return ExitErrorf(EX_USAGE, "invalid --naming-policy: %w", err)
 			}
 
-			xdsServer := xds.NewServer(grpc.MaxConcurrentStreams(1 << 20))
+			xdsServer.QualifyReferences(must.Bool(cmd.Flags().GetBool("qualify-references")))
+
+			// Serve the last good snapshot (if any) until the
+			// source has synced, rather than a partial configuration.
+			if path := must.String(cmd.Flags().GetString("snapshot-file")); path != "" {
+				if err := xdsServer.Restore(path); err != nil {
+					ctrl.Log.Error(err, "failed to restore snapshot", "path", path)
+				}
+
+				xdsServer.Persist(path)
 
-			envoyController := controllers.EnvoyReconciler{
-				Client:        mgr.GetClient(),
-				Log:           ctrl.Log.WithName("envoy.controller"),
-				Scheme:        mgr.GetScheme(),
-				ResourceStore: xdsServer,
+				// Write the last snapshot before exiting.
+				defer xdsServer.Flush()
 			}
 
-			if err := envoyController.SetupWithManager(mgr); err != nil {
-				return ExitErrorf(EX_FAIL, "unable to create Envoy reconciler: %w", err)
+			xdsServer.HoldUntilSynced()
+
+			var start func(<-chan struct{}) error
+
+			source := must.String(cmd.Flags().GetString("source"))
+
+			switch {
+			case source == "kubernetes":
+				mgr, reconcilers, err := newManager(cmd, xdsServer, policy)
+				if err != nil {
+					return err
+				}
+
+				// Only the leader reconciles resources, so only the
+				// leader can sync. A standby controller holds back
+				// snapshots, and isn't ready, until it is elected.
+				if err := mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+					waitForSync(mgr, reconcilers, xdsServer, stop)
+					return nil
+				})); err != nil {
+					return ExitErrorf(EX_FAIL, "unable to add sync runnable: %w", err)
+				}
+
+				start = mgr.Start
+
+			case strings.HasPrefix(source, "dir:"):
+				dir := strings.TrimPrefix(source, "dir:")
+				if info, err := os.Stat(dir); err != nil {
+					return &ExitError{EX_NOINPUT, err}
+				} else if !info.IsDir() {
+					return ExitErrorf(EX_NOINPUT, "%s is not a directory", dir)
+				}
+
+				// The status file would be loaded as a resource.
+				statusFile := must.String(cmd.Flags().GetString("status-file"))
+				if statusFile != "" && sameFile(filepath.Dir(statusFile), dir) {
+					return ExitErrorf(EX_USAGE, "the status file can't be in the source directory")
+				}
+
+				dirSource := &directorySource{
+					resourceLoader: resourceLoader{
+						Namespace:     NamespaceOrDefault(""),
+						StatusFile:    statusFile,
+						NamingPolicy:  policy,
+						ResourceStore: xdsServer,
+						Log:           ctrl.Log.WithName("directory.source"),
+						Synced:        xdsServer.MarkSynced,
+					},
+					Dir: dir,
+				}
+
+				start = dirSource.Start
+
+			case strings.HasPrefix(source, "git:"):
+				interval := must.Duration(cmd.Flags().GetDuration("git-poll-interval"))
+				if interval <= 0 {
+					return ExitErrorf(EX_USAGE, "invalid --git-poll-interval %s", interval)
+				}
+
+				gitSource := &gitSource{
+					resourceLoader: resourceLoader{
+						Namespace:     NamespaceOrDefault(""),
+						StatusFile:    must.String(cmd.Flags().GetString("status-file")),
+						NamingPolicy:  policy,
+						ResourceStore: xdsServer,
+						Log:           ctrl.Log.WithName("git.source"),
+						Synced:        xdsServer.MarkSynced,
+					},
+					Repository: strings.TrimPrefix(source, "git:"),
+					Ref:        must.String(cmd.Flags().GetString("git-ref")),
+					Path:       must.String(cmd.Flags().GetString("git-path")),
+					Interval:   interval,
+					Server:     xdsServer,
+				}
+
+				start = gitSource.Start
+
+			default:
+				return ExitErrorf(EX_USAGE, "unsupported --source %q", source)
 			}
 
 			errChan := make(chan error)
@@ -59,9 +155,24 @@ func NewRunCommand() *cobra.Command {
 				errChan <- nil
 			}()
 
+			if address := must.String(cmd.Flags().GetString("health-address")); address != "" {
+				healthServer := newHealthServer(address, xdsServer)
+
+				go func() {
+					if err := healthServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+						errChan <- ExitErrorf(EX_FAIL, "health server failed: %w", err)
+					}
+				}()
+
+				go func() {
+					<-stopChan
+					healthServer.Close() // nolint(errcheck)
+				}()
+			}
+
 			go func() {
-				if err := mgr.Start(stopChan); err != nil {
-					errChan <- ExitErrorf(EX_FAIL, "controller manager failed: %w", err)
+				if err := start(stopChan); err != nil {
+					errChan <- ExitErrorf(EX_FAIL, "%s source failed: %w", source, err)
 				}
 
 				errChan <- nil
@@ -76,10 +187,168 @@ func NewRunCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().String("source", "kubernetes",
+		"Where to read Envoy resources from: \"kubernetes\", \"dir:PATH\" for a directory, or \"git:REPO\" for a Git repository.")
+	cmd.Flags().String("status-file", "",
+		"The file to write the resource status to when reading a directory or Git repository.")
+	cmd.Flags().String("snapshot-file", "",
+		"The file to persist the last published snapshot to, and to restore it from at startup.")
+	cmd.Flags().String("git-ref", "HEAD", "The Git branch or ref to load resources from.")
+	cmd.Flags().String("git-path", ".", "The file or directory in the Git repository that holds the resources.")
+	cmd.Flags().Duration("git-poll-interval", 30*time.Second, "How often to poll the Git repository for new commits.")
 	cmd.Flags().String("metrics-address", ":8080", "The address the metric endpoint binds to.")
 	cmd.Flags().String("xds-address", "/var/run/xds.sock", "The address the xDS endpoint binds to.")
+	cmd.Flags().String("health-address", ":8081",
+		"The address the health and readiness endpoints bind to (empty to disable).")
+	cmd.Flags().StringSlice("hold-unresolved", xds.Kinds(),
+		"Resource kinds that are held back from Envoy until their references resolve.")
+	addNamingPolicyFlag(cmd.Flags())
+	cmd.Flags().Bool("qualify-references", false,
+		"Qualify unqualified resource references with the resource namespace (use with --naming-policy=force).")
+	cmd.Flags().String("secret-selector", "",
+		"Label selector for the Kubernetes Secrets to publish as SDS secrets (e.g. \"envoy.projectcontour.io/sds=true\").")
+	cmd.Flags().Bool("enable-endpoints", false,
+		"Publish the endpoints of annotated Services as ClusterLoadAssignments.")
 	cmd.Flags().Bool("enable-leader-election", false,
 		"Enable leader election to ensure there is only one active controller.")
+	cmd.Flags().Bool("enable-webhook", false,
+		"Enable the validating admission and CRD conversion webhooks (requires a serving certificate).")
+	cmd.Flags().Int("webhook-port", 9443, "The port the webhooks bind to.")
+	cmd.Flags().String("webhook-cert-dir", "",
+		"The directory containing the webhook TLS certificate and key.")
 
 	return &cmd
 }
+
+// resourceReconciler is a reconciler that stores resources in the
+// resource store.
+type resourceReconciler interface {
+	// WaitForCacheSync waits until the cache has synced every
+	// kind of object that the reconciler watches.
+	WaitForCacheSync(ctx context.Context, c cache.Cache) error
+	// ResourceNames lists the names of the resources that the
+	// reconciler stores.
+	ResourceNames(ctx context.Context) ([]xds.ResourceName, error)
+}
+
+// waitForSync tells the xDS server the current set of resources once
+// the manager cache has synced every kind of object that the
+// reconcilers watch. The server stays unsynced until the reconcilers
+// have handled each of the resources.
+func waitForSync(mgr ctrl.Manager, reconcilers []resourceReconciler, xdsServer *xds.Server, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	// Retry until we get a complete list, since marking the
+	// server synced with a partial list would withdraw resources.
+	_ = wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		var names []xds.ResourceName
+
+		for _, r := range reconcilers {
+			if err := r.WaitForCacheSync(ctx, mgr.GetCache()); err != nil {
+				ctrl.Log.Error(err, "failed to sync cache")
+				return false, nil
+			}
+
+			n, err := r.ResourceNames(ctx)
+			if err != nil {
+				ctrl.Log.Error(err, "failed to list resources")
+				return false, nil
+			}
+
+			names = append(names, n...)
+		}
+
+		ctrl.Log.Info("caches synced", "resources", len(names))
+		xdsServer.MarkSynced(names)
+
+		return true, nil
+	}, stop)
+}
+
+// newManager returns a controller manager that feeds the Envoy
+// resources in the Kubernetes cluster to the xDS server, and the
+// reconcilers that store resources.
+func newManager(
+	cmd *cobra.Command, xdsServer *xds.Server, policy xds.NamingPolicy,
+) (ctrl.Manager, []resourceReconciler, error) {
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:             kubernetes.NewScheme(),
+		MetricsBindAddress: must.String(cmd.Flags().GetString("metrics-address")),
+		LeaderElection:     must.Bool(cmd.Flags().GetBool("enable-leader-election")),
+		LeaderElectionID:   "06187118.projectcontour.io",
+		Port:               must.Int(cmd.Flags().GetInt("webhook-port")),
+		CertDir:            must.String(cmd.Flags().GetString("webhook-cert-dir")),
+	})
+	if err != nil {
+		return nil, nil, ExitErrorf(EX_FAIL, "unable to start manager: %w", err)
+	}
+
+	envoyController := controllers.EnvoyReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("envoy.controller"),
+		Scheme:        mgr.GetScheme(),
+		ResourceStore: xdsServer,
+		NamingPolicy:  policy,
+	}
+
+	if err := envoyController.SetupWithManager(mgr); err != nil {
+		return nil, nil, ExitErrorf(EX_FAIL, "unable to create Envoy reconciler: %w", err)
+	}
+
+	reconcilers := []resourceReconciler{&envoyController}
+
+	if selector := must.String(cmd.Flags().GetString("secret-selector")); selector != "" {
+		secretSelector, err := labels.Parse(selector)
+		if err != nil {
+			return nil, nil, ExitErrorf(EX_USAGE, "invalid --secret-selector: %w", err)
+		}
+
+		secretController := controllers.SecretReconciler{
+			Log:           ctrl.Log.WithName("secret.controller"),
+			ResourceStore: xdsServer,
+			Selector:      secretSelector,
+			NamingPolicy:  policy,
+		}
+
+		if err := secretController.SetupWithManager(mgr); err != nil {
+			return nil, nil, ExitErrorf(EX_FAIL, "unable to create Secret reconciler: %w", err)
+		}
+
+		reconcilers = append(reconcilers, &secretController)
+	}
+
+	if must.Bool(cmd.Flags().GetBool("enable-endpoints")) {
+		endpointController := controllers.EndpointReconciler{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("endpoints.controller"),
+			Scheme:        mgr.GetScheme(),
+			ResourceStore: xdsServer,
+			NamingPolicy:  policy,
+		}
+
+		if err := endpointController.SetupWithManager(mgr); err != nil {
+			return nil, nil, ExitErrorf(EX_FAIL, "unable to create endpoint reconciler: %w", err)
+		}
+
+		reconcilers = append(reconcilers, &endpointController)
+	}
+
+	if must.Bool(cmd.Flags().GetBool("enable-webhook")) {
+		envoyValidator := controllers.EnvoyValidator{
+			Scheme:       mgr.GetScheme(),
+			NamingPolicy: policy,
+		}
+
+		if err := envoyValidator.SetupWebhookWithManager(mgr); err != nil {
+			return nil, nil, ExitErrorf(EX_FAIL, "unable to create Envoy webhooks: %w", err)
+		}
+	}
+
+	return mgr, reconcilers, nil
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// sourceStatus is the content of the status file that a resource
+// source writes after each load.
+type sourceStatus struct {
+	Time      time.Time           `json:"time"`
+	Version   string              `json:"version,omitempty"`
+	Resources []*validationResult `json:"resources"`
+}
+
+// resourceLoader loads Envoy resources from files into the resource
+// store, and reports the results in the log and in a status file.
+type resourceLoader struct {
+	Namespace     string
+	StatusFile    string
+	NamingPolicy  xds.NamingPolicy
+	ResourceStore xds.ResourceStore
+	Log           logr.Logger
+
+	// Synced is called with the names of the loaded resources
+	// after the first load in which every document could be
+	// parsed (see xds.Server.MarkSynced).
+	Synced func([]xds.ResourceName)
+
+	// published is the set of resources in the store.
+	published map[xds.ResourceName]bool
+}
+
+// Load reads every resource in the named file or directory and updates
+// the resource store. Resources that were removed are deleted from the
+// store. Like the controller, a rejected resource leaves the previously
+// published version in place. If any file or document can't be parsed,
+// the resources it defined are unknown, so nothing is deleted until it
+// is fixed. The version is reported in the status file, and prefix is
+// trimmed from the source names of the resources.
+func (l *resourceLoader) Load(fname string, version string, prefix string) error {
+	if l.published == nil {
+		l.published = map[xds.ResourceName]bool{}
+	}
+
+	accepted := acceptDocuments([]string{fname}, l.Namespace, l.NamingPolicy)
+	results := accepted.Results
+
+	for _, r := range results {
+		r.Source = strings.TrimPrefix(r.Source, prefix)
+	}
+
+	storeResources(l.ResourceStore, accepted.Validated)
+
+	stored := map[xds.ResourceName]bool{}
+
+	for _, v := range accepted.Validated {
+		l.published[v.Name] = true
+		stored[v.Name] = true
+	}
+
+	for name := range accepted.Seen {
+		if !stored[name] {
+			l.ResourceStore.RejectResource(name)
+		}
+	}
+
+	if accepted.Unparsed > 0 {
+		l.Log.Info("not deleting resources while some documents can't be parsed",
+			"unparsed", accepted.Unparsed)
+	} else {
+		l.prune(accepted.Seen)
+	}
+
+	for _, r := range results {
+		log := l.Log.WithValues("source", r.Source, "kind", r.Kind, "name", r.Name)
+
+		if r.Valid {
+			log.Info("accepted resource")
+		} else {
+			log.Info("rejected resource", "reason", r.Reason, "message", r.Message)
+		}
+	}
+
+	if l.StatusFile == "" {
+		return nil
+	}
+
+	return writeStatusFile(l.StatusFile, &sourceStatus{
+		Time:      time.Now().UTC(),
+		Version:   version,
+		Resources: results,
+	})
+}
+
+// prune deletes the published resources that are no longer present,
+// and reports the present resources if the resource store is waiting
+// for them.
+func (l *resourceLoader) prune(seen map[xds.ResourceName]string) {
+	for name := range l.published {
+		if _, ok := seen[name]; !ok {
+			l.Log.Info("deleting resource", "resource", name)
+			l.ResourceStore.DeleteResource(name)
+			delete(l.published, name)
+		}
+	}
+
+	if l.Synced != nil {
+		names := make([]xds.ResourceName, 0, len(seen))
+		for name := range seen {
+			names = append(names, name)
+		}
+
+		l.Synced(names)
+		l.Synced = nil
+	}
+}
+
+// directorySource feeds the Envoy resources in a directory to the
+// resource store. The directory is reloaded whenever it changes.
+type directorySource struct {
+	resourceLoader
+
+	Dir string
+}
+
+// Start loads the directory, then watches it and reloads it on
+// every change until the stop channel is closed.
+func (d *directorySource) Start(stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close() // nolint(errcheck)
+
+	if err := watcher.Add(d.Dir); err != nil {
+		return fmt.Errorf("failed to watch %q: %w", d.Dir, err)
+	}
+
+	if err := d.Load(d.Dir, "", ""); err != nil {
+		d.Log.Error(err, "failed to write status file", "path", d.StatusFile)
+	}
+
+	// Editors and tools like "git checkout" make bursts of
+	// changes, so wait for things to settle before reloading.
+	const settle = 250 * time.Millisecond
+
+	reload := time.NewTimer(settle)
+	reload.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if !isResourceFile(event.Name) {
+				continue
+			}
+
+			reload.Reset(settle)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			d.Log.Error(err, "directory watch failed", "path", d.Dir)
+
+		case <-reload.C:
+			if err := d.Load(d.Dir, "", ""); err != nil {
+				d.Log.Error(err, "failed to write status file", "path", d.StatusFile)
+			}
+		}
+	}
+}
+
+// isResourceFile returns true if a change to the named file could
+// change the resources in the directory. Names starting with ".." are
+// the symlinks that Kubernetes swaps to update mounted volumes.
+func isResourceFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return strings.HasPrefix(filepath.Base(name), "..")
+	}
+}
+
+// sameFile returns true if both names refer to the same file.
+func sameFile(a string, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(infoA, infoB)
+}
+
+// writeStatusFile atomically replaces the status file, so that
+// readers never see a partial status.
+func writeStatusFile(path string, status *sourceStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // nolint(errcheck)
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close() // nolint(errcheck)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,456 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/controllers"
+	"github.com/jpeach/envoy-controller/pkg/kubernetes"
+	"github.com/jpeach/envoy-controller/pkg/must"
+	"github.com/jpeach/envoy-controller/pkg/version"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// validationResult is the outcome of validating a single resource.
+type validationResult struct {
+	Source  string `json:"source"`
+	Kind    string `json:"kind,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Valid   bool   `json:"valid"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r *validationResult) fail(reason string, message string) {
+	r.Valid = false
+	r.Reason = reason
+	r.Message = message
+}
+
+// validatedResource is a resource that passed AcceptResource, and
+// still needs its references checked.
+type validatedResource struct {
+	Result  *validationResult
+	Name    xds.ResourceName
+	Version string
+	Nodes   xds.NodeSelector
+	Message proto.Message
+}
+
+// NewValidateCommand ...
+func NewValidateCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "validate [OPTIONS]",
+		Short: "Validate Envoy resources without a cluster",
+		Long: `Validate Envoy resources without a cluster
+
+Each input document is either an Envoy resource in the protobuf JSON (or
+YAML) format, or a Kubernetes Envoy resource manifest. Other Kubernetes
+objects are ignored. Each resource is checked in the same way as the
+controller checks it, and the references between the resources are
+checked to make sure that they resolve.
+
+The exit status is 0 if every resource is valid, and 65 otherwise.
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := must.String(cmd.Flags().GetString("output"))
+			switch format {
+			case "text", "json", "junit":
+			default:
+				return ExitErrorf(EX_USAGE, "unsupported output format %q", format)
+			}
+
+			namespace := NamespaceOrDefault(must.String(cmd.Flags().GetString("namespace")))
+
+			policy, err := namingPolicy(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			accepted := acceptDocuments(
+				must.StringSlice(cmd.Flags().GetStringSlice("filename")), namespace, policy)
+
+			checkReferences(accepted.Validated, must.Bool(cmd.Flags().GetBool("qualify-references")))
+
+			results := accepted.Results
+
+			if err := printValidationResults(os.Stdout, format, results); err != nil {
+				return &ExitError{EX_FAIL, err}
+			}
+
+			failed := 0
+			for _, r := range results {
+				if !r.Valid {
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return ExitErrorf(EX_DATAERR, "%d of %d resources failed validation", failed, len(results))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("namespace", "n", "",
+		"The namespace of Envoy resources and manifests that don't specify one.")
+	cmd.Flags().StringSliceP("filename", "f", []string{"-"},
+		"File or directory containing the resources to validate (may be repeated).")
+	addNamingPolicyFlag(cmd.Flags())
+	cmd.Flags().Bool("qualify-references", false,
+		"Qualify unqualified resource references with the resource namespace.")
+	cmd.Flags().StringP("output", "o", "text", "Output the results as text, JSON or JUnit XML (text|json|junit).")
+
+	return &cmd
+}
+
+// acceptedDocuments is the outcome of accepting the resources in a
+// set of files.
+type acceptedDocuments struct {
+	// Results has a result for each resource, and for each file or
+	// document that couldn't be parsed.
+	Results []*validationResult
+
+	// Validated is the resources that were accepted.
+	Validated []validatedResource
+
+	// Seen maps the names of all the resources that were read to
+	// their sources.
+	Seen map[xds.ResourceName]string
+
+	// Unparsed is the number of files and documents that couldn't
+	// be parsed. The resources they define are unknown, so they
+	// are missing from Seen.
+	Unparsed int
+}
+
+// acceptDocuments reads the resources from the named files and
+// directories, and accepts them in the same way as the controller.
+// Files and documents that can't be parsed are reported as
+// InvalidFormat results, and the remaining files are still read.
+func acceptDocuments(fnames []string, namespace string, policy xds.NamingPolicy) *acceptedDocuments {
+	accepted := &acceptedDocuments{
+		Seen: map[xds.ResourceName]string{},
+	}
+
+	for _, fname := range fnames {
+		for _, f := range readInputFiles(fname) {
+			if f.Err != nil {
+				accepted.Unparsed++
+				accepted.Results = append(accepted.Results, &validationResult{
+					Source: f.Source, Reason: "InvalidFormat", Message: f.Err.Error(),
+				})
+				continue
+			}
+
+			accepted.accept(f.Documents, namespace, policy)
+		}
+	}
+
+	return accepted
+}
+
+// accept accepts the resources in the documents read from one file.
+func (a *acceptedDocuments) accept(raw []rawDocument, namespace string, policy xds.NamingPolicy) {
+	for _, r := range raw {
+		result := &validationResult{Source: r.Source, Valid: true}
+
+		obj, gvk, err := objectForDocument(r, namespace)
+		switch {
+		case err != nil:
+			result.fail("InvalidFormat", err.Error())
+			a.Unparsed++
+			a.Results = append(a.Results, result)
+			continue
+		case obj == nil:
+			continue
+		}
+
+		m := must.Object(meta.Accessor(obj))
+		name := controllers.ResourceNameOf(
+			types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}, gvk)
+
+		result.Kind = gvk.Kind
+		result.Name = fmt.Sprintf("%s/%s", m.GetNamespace(), m.GetName())
+		a.Results = append(a.Results, result)
+
+		if previous, ok := a.Seen[name]; ok {
+			result.fail("DuplicateResource", fmt.Sprintf("resource is also defined in %s", previous))
+			continue
+		}
+
+		a.Seen[name] = r.Source
+
+		message, aerr := controllers.AcceptResource(obj, gvk)
+		if aerr == nil {
+			aerr = controllers.ApplyNamingPolicy(policy, obj, message)
+		}
+
+		if aerr != nil {
+			result.fail(aerr.Reason, aerr.Message)
+			continue
+		}
+
+		a.Validated = append(a.Validated, validatedResource{
+			Result:  result,
+			Name:    name,
+			Version: fmt.Sprintf("%x", sha256.Sum256(r.Data)),
+			Nodes:   xds.NodeSelector(obj.GetSpecNodes()),
+			Message: message,
+		})
+	}
+}
+
+// objectForDocument returns the Envoy resource object for a raw
+// Envoy resource or Kubernetes manifest document. Kubernetes objects
+// that aren't Envoy resources are skipped by returning a nil object.
+func objectForDocument(raw rawDocument, namespace string) (envoyv1alpha1.Object, schema.GroupVersionKind, error) {
+	var probe struct {
+		Type       string `json:"@type"`
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+
+	if err := json.Unmarshal(raw.Data, &probe); err != nil {
+		return nil, schema.GroupVersionKind{}, err
+	}
+
+	switch {
+	case probe.Type != "":
+		d, err := decodeDocument(raw)
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		name, err := objectNameFor(xds.NameOf(d.Message))
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		message, err := newMessage(d.Message, envoyv1alpha1.MessageEncodingBinary)
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		obj, err := newResource(d.Kind, metav1.ObjectMeta{Namespace: namespace, Name: name}, message, nil)
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		return obj.(envoyv1alpha1.Object), envoyv1alpha1.GroupVersion.WithKind(d.Kind), nil
+
+	case probe.APIVersion != "":
+		gv, err := schema.ParseGroupVersion(probe.APIVersion)
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		if gv.Group != envoyv1alpha1.GroupVersion.Group {
+			return nil, schema.GroupVersionKind{}, nil
+		}
+
+		scheme := kubernetes.NewScheme()
+
+		obj, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(raw.Data, nil, nil)
+		if err != nil {
+			return nil, schema.GroupVersionKind{}, err
+		}
+
+		// Convert other API versions to the version that the
+		// controller accepts.
+		if convertible, ok := obj.(conversion.Convertible); ok {
+			hub, err := scheme.New(envoyv1alpha1.GroupVersion.WithKind(probe.Kind))
+			if err != nil {
+				return nil, schema.GroupVersionKind{}, err
+			}
+
+			if err := convertible.ConvertTo(hub.(conversion.Hub)); err != nil {
+				return nil, schema.GroupVersionKind{}, err
+			}
+
+			obj = hub
+		}
+
+		envoyObj, ok := obj.(envoyv1alpha1.Object)
+		if !ok {
+			return nil, schema.GroupVersionKind{}, fmt.Errorf("%s is not an Envoy resource", probe.Kind)
+		}
+
+		if m := must.Object(meta.Accessor(obj)); m.GetNamespace() == "" {
+			m.SetNamespace(namespace)
+		}
+
+		return envoyObj, envoyv1alpha1.GroupVersion.WithKind(probe.Kind), nil
+
+	default:
+		return nil, schema.GroupVersionKind{}, errors.New("document is neither an Envoy resource nor a Kubernetes object")
+	}
+}
+
+// checkReferences fails the validated resources that the controller
+// couldn't store, or whose references don't resolve.
+func checkReferences(validated []validatedResource, qualify bool) {
+	resources := make([]xds.Resource, 0, len(validated))
+	results := make(map[xds.ResourceName]*validationResult, len(validated))
+
+	for _, v := range validated {
+		// The server rejects v2 resources that it can't
+		// upgrade for v3 clients.
+		if xds.VersionForMessage(v.Message.ProtoReflect().Descriptor()) == xds.EnvoyVersion2 {
+			if _, err := xds.TranslateV3(v.Message); err != nil {
+				v.Result.fail("StoreFailed", fmt.Sprintf("failed to translate v2 resource: %s", err))
+				continue
+			}
+		}
+
+		resources = append(resources, xds.Resource{Name: v.Name, Nodes: v.Nodes, Message: v.Message})
+		results[v.Name] = v.Result
+	}
+
+	unresolved, conflicts := xds.ResolveReferences(resources, qualify)
+
+	for name, err := range conflicts {
+		results[name].fail("NameConflict", err.Error())
+	}
+
+	for name, refs := range unresolved {
+		results[name].fail("UnresolvedRefs", unresolvedMessage(refs))
+	}
+}
+
+// storeResources updates the validated resources in the resource
+// store, and fails the resources that can't be stored or whose
+// references don't resolve.
+func storeResources(store xds.ResourceStore, validated []validatedResource) {
+	for _, v := range validated {
+		vers := xds.ResourceVersion{Identifier: string(v.Name), Version: v.Version}
+
+		err := store.UpdateResource(v.Name, vers, v.Nodes, v.Message)
+
+		var conflict *xds.NameConflictError
+
+		switch {
+		case errors.As(err, &conflict):
+			v.Result.fail("NameConflict", err.Error())
+		case err != nil:
+			v.Result.fail("StoreFailed", err.Error())
+		}
+	}
+
+	for _, v := range validated {
+		if !v.Result.Valid {
+			continue
+		}
+
+		if unresolved := store.UnresolvedReferences(v.Name); len(unresolved) > 0 {
+			v.Result.fail("UnresolvedRefs", unresolvedMessage(unresolved))
+		}
+	}
+}
+
+// unresolvedMessage describes a list of unresolved references.
+func unresolvedMessage(unresolved []xds.Reference) string {
+	refs := make([]string, 0, len(unresolved))
+	for _, r := range unresolved {
+		refs = append(refs, r.String())
+	}
+
+	return "unresolved references to " + strings.Join(refs, ", ")
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func printValidationResults(out io.Writer, format string, results []*validationResult) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+
+	case "junit":
+		suite := junitTestSuite{
+			Name:  fmt.Sprintf("%s validate", version.Progname),
+			Tests: len(results),
+		}
+
+		for _, r := range results {
+			c := junitTestCase{
+				ClassName: r.Source,
+				Name:      strings.TrimSpace(r.Kind + " " + r.Name),
+			}
+
+			if !r.Valid {
+				c.Failure = &junitFailure{Type: r.Reason, Message: r.Message}
+				suite.Failures++
+			}
+
+			suite.TestCases = append(suite.TestCases, c)
+		}
+
+		data, err := xml.MarshalIndent(struct {
+			XMLName xml.Name `xml:"testsuites"`
+			Suites  []junitTestSuite
+		}{Suites: []junitTestSuite{suite}}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, data)
+		return err
+
+	default:
+		for _, r := range results {
+			what := r.Source
+			if r.Kind != "" {
+				what = fmt.Sprintf("%s: %s %s", r.Source, r.Kind, r.Name)
+			}
+
+			if r.Valid {
+				fmt.Fprintf(out, "%s: OK\n", what)
+			} else {
+				fmt.Fprintf(out, "%s: %s: %s\n", what, r.Reason, r.Message)
+			}
+		}
+
+		return nil
+	}
+}
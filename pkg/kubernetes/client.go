@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	envoyv1alpha2 "github.com/jpeach/envoy-controller/api/v1alpha2"
 	"github.com/jpeach/envoy-controller/pkg/must"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -15,6 +16,7 @@ func NewScheme() *runtime.Scheme {
 	s := runtime.NewScheme()
 	must.Must(scheme.AddToScheme(s))
 	must.Must(envoyv1alpha1.AddToScheme(s))
+	must.Must(envoyv1alpha2.AddToScheme(s))
 
 	return s
 }
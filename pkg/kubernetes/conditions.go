@@ -13,11 +13,11 @@ import (
 // available, which should be  Kubernetes 1.19.
 type Condition = v1alpha1.Condition
 
-// NewAcceptedCondition returns a *v1alpha1.Condition initialized for the given runtime.Object.
-func NewAcceptedCondition(obj runtime.Object) *Condition {
+// NewCondition returns a *v1alpha1.Condition of the given type initialized for the given runtime.Object.
+func NewCondition(obj runtime.Object, conditionType string) *Condition {
 	m := must.Object(meta.Accessor(obj))
 	c := v1alpha1.Condition{
-		Type:               "Accepted",
+		Type:               conditionType,
 		Status:             metav1.ConditionTrue,
 		ObservedGeneration: m.GetGeneration(),
 		LastTransitionTime: metav1.Now(),
@@ -28,6 +28,49 @@ func NewAcceptedCondition(obj runtime.Object) *Condition {
 	return &c
 }
 
+// NewAcceptedCondition returns a *v1alpha1.Condition initialized for the given runtime.Object.
+func NewAcceptedCondition(obj runtime.Object) *Condition {
+	return NewCondition(obj, "Accepted")
+}
+
+// NewProgrammedCondition returns a *v1alpha1.Condition initialized for the given runtime.Object.
+func NewProgrammedCondition(obj runtime.Object) *Condition {
+	return NewCondition(obj, "Programmed")
+}
+
+// NewResolvedRefsCondition returns a *v1alpha1.Condition initialized for the given runtime.Object.
+func NewResolvedRefsCondition(obj runtime.Object) *Condition {
+	return NewCondition(obj, "ResolvedRefs")
+}
+
+// SetCondition returns a copy of conditions with c replacing any
+// existing condition of the same type. If the status of the condition
+// has not changed, its original LastTransitionTime is preserved.
+func SetCondition(conditions []Condition, c Condition) []Condition {
+	result := make([]Condition, 0, len(conditions)+1)
+	replaced := false
+
+	for _, existing := range conditions {
+		if existing.Type != c.Type {
+			result = append(result, existing)
+			continue
+		}
+
+		if existing.Status == c.Status {
+			c.LastTransitionTime = existing.LastTransitionTime
+		}
+
+		result = append(result, c)
+		replaced = true
+	}
+
+	if !replaced {
+		result = append(result, c)
+	}
+
+	return result
+}
+
 // AcceptanceError captures the reason that a resource update was not accepted.
 type AcceptanceError struct {
 	Reason  string
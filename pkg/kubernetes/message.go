@@ -0,0 +1,28 @@
+package kubernetes
+
+import (
+	"errors"
+
+	envoyv1alpha1 "github.com/jpeach/envoy-controller/api/v1alpha1"
+	"github.com/jpeach/envoy-controller/pkg/xds"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DecodeMessage decodes the protobuf message from either its binary
+// or its JSON form.
+func DecodeMessage(m *envoyv1alpha1.Message) (proto.Message, error) {
+	switch m.Encoding() {
+	case envoyv1alpha1.MessageEncodingJSON:
+		if m.Type != "" || len(m.Value) > 0 {
+			return nil, errors.New("message has both binary and JSON forms")
+		}
+
+		return xds.UnmarshalJSON(m.JSON.Raw)
+	default:
+		return xds.UnmarshalAny(&xds.Any{
+			TypeUrl: m.Type,
+			Value:   m.Value,
+		})
+	}
+}
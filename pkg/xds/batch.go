@@ -0,0 +1,85 @@
+package xds
+
+import (
+	"strconv"
+)
+
+// Batch calls update, and publishes all the resource changes that it
+// makes as a single snapshot, so that Envoy never sees a partial
+// update. If label is not empty, it is used as the snapshot version,
+// which Envoy reports as the version_info of its configuration.
+// Changes that other goroutines make while update runs are published
+// in the same snapshot. Batch returns the error from update, but the
+// changes are published regardless.
+func (srv *Server) Batch(label string, update func() error) error {
+	srv.batchLock.Lock()
+	defer srv.batchLock.Unlock()
+
+	srv.lock.Lock()
+	srv.batching = true
+	srv.lock.Unlock()
+
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	defer func() {
+		srv.lock.Lock()
+		defer srv.lock.Unlock()
+
+		srv.batching = false
+		srv.label = label
+		changed = srv.publish()
+		srv.label = ""
+	}()
+
+	return update()
+}
+
+// nextVersion advances the snapshot version and returns its string
+// form. The caller must hold the resource table lock.
+func (srv *Server) nextVersion() string {
+	srv.version++
+
+	version := strconv.FormatUint(srv.version, 10)
+
+	// Envoy only applies a snapshot whose version differs from
+	// the version it has, so never repeat a label.
+	switch {
+	case srv.label == "":
+	case srv.label == srv.versionInfo:
+		version = srv.label + "." + version
+		srv.labels[version] = srv.version
+	default:
+		version = srv.label
+		srv.labels[version] = srv.version
+	}
+
+	srv.versionInfo = version
+
+	// Forget the labels of versions that are no longer published.
+	// A response for the previous version may still be in flight,
+	// so keep its label until the next version.
+	for label, vers := range srv.labels {
+		if vers+1 < srv.version {
+			delete(srv.labels, label)
+		}
+	}
+
+	return version
+}
+
+// parseVersion returns the snapshot version for the given string form.
+// The caller must hold the resource table lock.
+func (srv *Server) parseVersion(version string) (uint64, bool) {
+	if vers, ok := srv.labels[version]; ok {
+		return vers, true
+	}
+
+	vers, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return vers, true
+}
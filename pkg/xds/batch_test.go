@@ -0,0 +1,76 @@
+package xds
+
+import (
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPublishesBatches(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"}))
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+	assert.Equal(t, "1", snap.GetVersion(resourceV3.ClusterType))
+
+	require.NoError(t, srv.Batch("0123abc", func() error {
+		srv.DeleteResource("default/cluster/one")
+		require.NoError(t, srv.UpdateResource("default/cluster/two",
+			ResourceVersion{Identifier: "2", Version: "1"}, nil,
+			&clusterV3.Cluster{Name: "two"}))
+
+		// Nothing is published until the batch ends.
+		snap, err := srv.cacheV3.GetSnapshot("")
+		require.NoError(t, err)
+		assert.Equal(t, "1", snap.GetVersion(resourceV3.ClusterType))
+
+		return nil
+	}))
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abc", snap.GetVersion(resourceV3.ClusterType))
+	assert.NotContains(t, snap.GetResources(resourceV3.ClusterType), "one")
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "two")
+
+	// Envoy ACKs the labelled version.
+	stream := streamKey{Version: EnvoyVersion3, ID: 1}
+
+	srv.streamResponse(stream, "", resourceV3.ClusterType, "1", "0123abc")
+	srv.streamRequest(stream, "", resourceV3.ClusterType, "1", "")
+
+	assert.Equal(t, ResourceStatus{Acked: true}, srv.ResourceStatus("default/cluster/two"))
+
+	// A repeated label still publishes a distinct version.
+	require.NoError(t, srv.Batch("0123abc", func() error {
+		return srv.UpdateResource("default/cluster/two",
+			ResourceVersion{Identifier: "2", Version: "2"}, nil,
+			&clusterV3.Cluster{Name: "two", AltStatName: "two"})
+	}))
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abc.3", snap.GetVersion(resourceV3.ClusterType))
+
+	// The labels of versions that are no longer published are
+	// forgotten.
+	require.NoError(t, srv.UpdateResource("default/cluster/three",
+		ResourceVersion{Identifier: "3", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "three"}))
+
+	assert.Equal(t, map[string]uint64{"0123abc.3": 3}, srv.labels)
+
+	require.NoError(t, srv.UpdateResource("default/cluster/four",
+		ResourceVersion{Identifier: "4", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "four"}))
+
+	assert.Empty(t, srv.labels)
+}
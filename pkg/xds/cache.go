@@ -0,0 +1,157 @@
+package xds
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cacheV3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+)
+
+// opaqueSnapshot is a versioned set of resources of a single type.
+type opaqueSnapshot struct {
+	Version   string
+	Resources map[string]types.Resource
+}
+
+// opaqueWatch is an open state-of-the-world watch.
+type opaqueWatch struct {
+	Request  *cacheV3.Request
+	Response chan cacheV3.Response
+}
+
+// opaqueCache is a v3 state-of-the-world cache for a single resource
+// type that the go-control-plane snapshot cache doesn't know about
+// (e.g. scoped routes). Like the snapshot cache, it holds a versioned
+// set of resources for each node group.
+type opaqueCache struct {
+	hash cacheV3.NodeHash
+
+	lock      sync.Mutex
+	watchID   int64
+	snapshots map[string]opaqueSnapshot
+	watches   map[string]map[int64]opaqueWatch
+}
+
+var _ cacheV3.Cache = &opaqueCache{}
+
+func newOpaqueCache(hash cacheV3.NodeHash) *opaqueCache {
+	return &opaqueCache{
+		hash:      hash,
+		snapshots: map[string]opaqueSnapshot{},
+		watches:   map[string]map[int64]opaqueWatch{},
+	}
+}
+
+// SetResources replaces the resources for the given node group,
+// and responds to any watches that are waiting for a new version.
+func (c *opaqueCache) SetResources(group string, version string, resources []types.Resource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	snap := opaqueSnapshot{
+		Version:   version,
+		Resources: make(map[string]types.Resource, len(resources)),
+	}
+
+	for _, r := range resources {
+		snap.Resources[NameOf(ProtoV2(r))] = r
+	}
+
+	c.snapshots[group] = snap
+
+	for id, w := range c.watches[group] {
+		if w.Request.GetVersionInfo() != version {
+			respondOpaque(w, snap)
+			delete(c.watches[group], id)
+		}
+	}
+}
+
+// CreateWatch returns a watch for the resources of the requested
+// type. If the request is behind the current version, the watch
+// responds immediately.
+func (c *opaqueCache) CreateWatch(req *cacheV3.Request) (chan cacheV3.Response, func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	group := c.hash.ID(req.GetNode())
+	w := opaqueWatch{
+		Request:  req,
+		Response: make(chan cacheV3.Response, 1),
+	}
+
+	if snap, ok := c.snapshots[group]; ok && snap.Version != req.GetVersionInfo() {
+		respondOpaque(w, snap)
+		return w.Response, nil
+	}
+
+	c.watchID++
+	id := c.watchID
+
+	if c.watches[group] == nil {
+		c.watches[group] = map[int64]opaqueWatch{}
+	}
+
+	c.watches[group][id] = w
+
+	return w.Response, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		delete(c.watches[group], id)
+	}
+}
+
+// Fetch is not supported.
+func (c *opaqueCache) Fetch(context.Context, *cacheV3.Request) (cacheV3.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
+func respondOpaque(w opaqueWatch, snap opaqueSnapshot) {
+	var resources []types.Resource
+
+	// An empty list of names is a wildcard request.
+	if names := w.Request.GetResourceNames(); len(names) > 0 {
+		for _, n := range names {
+			if r, ok := snap.Resources[n]; ok {
+				resources = append(resources, r)
+			}
+		}
+	} else {
+		for _, r := range snap.Resources {
+			resources = append(resources, r)
+		}
+	}
+
+	w.Response <- &cacheV3.RawResponse{
+		Request:   w.Request,
+		Version:   snap.Version,
+		Resources: resources,
+	}
+}
+
+// typeMuxCache routes requests to a cache by their type URL. Requests
+// for types that aren't in the map go to the cache with the empty key.
+type typeMuxCache map[string]cacheV3.Cache
+
+var _ cacheV3.Cache = typeMuxCache{}
+
+func (m typeMuxCache) cacheFor(req *cacheV3.Request) cacheV3.Cache {
+	if c, ok := m[req.GetTypeUrl()]; ok {
+		return c
+	}
+
+	return m[""]
+}
+
+// CreateWatch creates a watch on the cache for the requested type.
+func (m typeMuxCache) CreateWatch(req *cacheV3.Request) (chan cacheV3.Response, func()) {
+	return m.cacheFor(req).CreateWatch(req)
+}
+
+// Fetch fetches from the cache for the requested type.
+func (m typeMuxCache) Fetch(ctx context.Context, req *cacheV3.Request) (cacheV3.Response, error) {
+	return m.cacheFor(req).Fetch(ctx, req)
+}
@@ -0,0 +1,52 @@
+package xds
+
+import (
+	discoveryV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryV3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	serverV2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	serverV3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+)
+
+// callbacksV2 returns the xDS stream callbacks for the v2 server.
+func (srv *Server) callbacksV2() serverV2.Callbacks {
+	return serverV2.CallbackFuncs{
+		StreamRequestFunc: func(streamID int64, req *discoveryV2.DiscoveryRequest) error {
+			group := req.GetNode().GetCluster()
+
+			srv.observeNodeGroup(group)
+			srv.streamRequest(streamKey{Version: EnvoyVersion2, ID: streamID}, group,
+				req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail().GetMessage())
+
+			return nil
+		},
+		StreamResponseFunc: func(streamID int64, req *discoveryV2.DiscoveryRequest, resp *discoveryV2.DiscoveryResponse) {
+			srv.streamResponse(streamKey{Version: EnvoyVersion2, ID: streamID}, req.GetNode().GetCluster(),
+				resp.GetTypeUrl(), resp.GetNonce(), resp.GetVersionInfo())
+		},
+		StreamClosedFunc: func(streamID int64) {
+			srv.streamClosed(streamKey{Version: EnvoyVersion2, ID: streamID})
+		},
+	}
+}
+
+// callbacksV3 returns the xDS stream callbacks for the v3 server.
+func (srv *Server) callbacksV3() serverV3.Callbacks {
+	return serverV3.CallbackFuncs{
+		StreamRequestFunc: func(streamID int64, req *discoveryV3.DiscoveryRequest) error {
+			group := req.GetNode().GetCluster()
+
+			srv.observeNodeGroup(group)
+			srv.streamRequest(streamKey{Version: EnvoyVersion3, ID: streamID}, group,
+				req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail().GetMessage())
+
+			return nil
+		},
+		StreamResponseFunc: func(streamID int64, req *discoveryV3.DiscoveryRequest, resp *discoveryV3.DiscoveryResponse) {
+			srv.streamResponse(streamKey{Version: EnvoyVersion3, ID: streamID}, req.GetNode().GetCluster(),
+				resp.GetTypeUrl(), resp.GetNonce(), resp.GetVersionInfo())
+		},
+		StreamClosedFunc: func(streamID int64) {
+			srv.streamClosed(streamKey{Version: EnvoyVersion3, ID: streamID})
+		},
+	}
+}
@@ -0,0 +1,373 @@
+package xds
+
+import (
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	clusterserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discoveryV3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	listenerserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	routeserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	runtimeserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
+	secretserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverV3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// deltaStream is an incremental xDS stream.
+type deltaStream interface {
+	grpc.ServerStream
+
+	Send(*discoveryV3.DeltaDiscoveryResponse) error
+	Recv() (*discoveryV3.DeltaDiscoveryRequest, error)
+}
+
+// deltaResource is a resource to be sent on a delta stream. A resource
+// with a nil Message tells Envoy that the resource it subscribed to
+// (by alias) does not exist.
+type deltaResource struct {
+	Version string
+	Message proto.Message
+	Aliases []string
+}
+
+// deltaResolver returns the resources of a given type that satisfy
+// a subscription from a node group. The caller must hold the resource
+// table lock.
+type deltaResolver func(group string, sub *deltaSubscription) map[string]deltaResource
+
+// deltaServerV3 adds the incremental xDS methods to the go-control-plane
+// v3 server, which only implements the state-of-the-world protocol.
+type deltaServerV3 struct {
+	serverV3.Server
+
+	srv *Server
+}
+
+var _ serverV3.Server = deltaServerV3{}
+
+func (d deltaServerV3) DeltaAggregatedResources(
+	stream discoveryV3.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	return d.srv.streamDelta(stream, "")
+}
+
+func (d deltaServerV3) DeltaEndpoints(stream endpointserviceV3.EndpointDiscoveryService_DeltaEndpointsServer) error {
+	return d.srv.streamDelta(stream, resourceV3.EndpointType)
+}
+
+func (d deltaServerV3) DeltaClusters(stream clusterserviceV3.ClusterDiscoveryService_DeltaClustersServer) error {
+	return d.srv.streamDelta(stream, resourceV3.ClusterType)
+}
+
+func (d deltaServerV3) DeltaRoutes(stream routeserviceV3.RouteDiscoveryService_DeltaRoutesServer) error {
+	return d.srv.streamDelta(stream, resourceV3.RouteType)
+}
+
+func (d deltaServerV3) DeltaListeners(stream listenerserviceV3.ListenerDiscoveryService_DeltaListenersServer) error {
+	return d.srv.streamDelta(stream, resourceV3.ListenerType)
+}
+
+func (d deltaServerV3) DeltaSecrets(stream secretserviceV3.SecretDiscoveryService_DeltaSecretsServer) error {
+	return d.srv.streamDelta(stream, resourceV3.SecretType)
+}
+
+func (d deltaServerV3) DeltaRuntime(stream runtimeserviceV3.RuntimeDiscoveryService_DeltaRuntimeServer) error {
+	return d.srv.streamDelta(stream, resourceV3.RuntimeType)
+}
+
+// deltaSubscription tracks the resources of one type that Envoy has
+// subscribed to on a delta stream.
+type deltaSubscription struct {
+	TypeURL string
+	Names   map[string]struct{}
+
+	// Wildcard is true if Envoy subscribed to every resource,
+	// by sending no names in its first request. Unsubscribing
+	// from every name later doesn't make a wildcard.
+	Wildcard bool
+
+	// Sent maps resource names to the version last sent to Envoy.
+	Sent map[string]string
+	// Responded is true once Envoy has received a response.
+	Responded bool
+}
+
+// streamDelta serves an incremental xDS stream. defaultTypeURL is the
+// type of the resources that the stream serves, which is empty for
+// aggregated streams.
+func (srv *Server) streamDelta(stream deltaStream, defaultTypeURL string) error {
+	key := streamKey{
+		Version: EnvoyVersion3,
+		Delta:   true,
+		ID:      atomic.AddInt64(&srv.deltaStreamID, 1),
+	}
+
+	wake := make(chan struct{}, 1)
+
+	srv.lock.Lock()
+	srv.deltaWatchers[key] = wake
+	srv.lock.Unlock()
+
+	defer func() {
+		srv.lock.Lock()
+		delete(srv.deltaWatchers, key)
+		srv.lock.Unlock()
+
+		srv.streamClosed(key)
+	}()
+
+	requests := make(chan *discoveryV3.DeltaDiscoveryRequest)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var nonce int64
+
+	node := &coreV3.Node{}
+	subscriptions := map[string]*deltaSubscription{}
+
+	send := func(sub *deltaSubscription) error {
+		nonce++
+
+		resp := srv.deltaResponse(key, node.GetCluster(), sub, strconv.FormatInt(nonce, 10))
+		if resp == nil {
+			return nil
+		}
+
+		return stream.Send(resp)
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+
+		case <-wake:
+			for _, sub := range subscriptions {
+				if err := send(sub); err != nil {
+					return err
+				}
+			}
+
+		case req := <-requests:
+			// The node is only required on the first request.
+			if req.GetNode() != nil {
+				node = req.GetNode()
+			}
+
+			typeURL := req.GetTypeUrl()
+			if typeURL == "" {
+				typeURL = defaultTypeURL
+			}
+
+			if typeURL == "" {
+				return status.Errorf(codes.InvalidArgument, "type URL is required for aggregated streams")
+			}
+
+			// Envoy can ask for types that we don't know about on
+			// aggregated streams, so just ignore those.
+			if srv.resolverFor(typeURL) == nil {
+				srv.log.V(1).Info("ignoring unsupported delta type", "type", typeURL)
+				continue
+			}
+
+			srv.observeNodeGroup(node.GetCluster())
+			srv.streamRequest(key, node.GetCluster(), typeURL,
+				req.GetResponseNonce(), req.GetErrorDetail().GetMessage())
+
+			sub, ok := subscriptions[typeURL]
+			if !ok {
+				sub = &deltaSubscription{
+					TypeURL:  typeURL,
+					Names:    map[string]struct{}{},
+					Sent:     map[string]string{},
+					Wildcard: len(req.GetResourceNamesSubscribe()) == 0,
+				}
+
+				// On reconnect, Envoy tells us what it already has.
+				for name, vers := range req.GetInitialResourceVersions() {
+					sub.Sent[name] = vers
+				}
+
+				subscriptions[typeURL] = sub
+			}
+
+			for _, name := range req.GetResourceNamesSubscribe() {
+				sub.Names[name] = struct{}{}
+			}
+
+			for _, name := range req.GetResourceNamesUnsubscribe() {
+				delete(sub.Names, name)
+				delete(sub.Sent, name)
+			}
+
+			// Pure ACKs and NACKs don't need a response.
+			if sub.Responded && len(req.GetResourceNamesSubscribe()) == 0 {
+				continue
+			}
+
+			if err := send(sub); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// deltaResponse returns the response that brings Envoy up to date
+// with the current state of the subscription, or nil if Envoy is
+// already up to date or there are changes that are yet to be
+// published.
+func (srv *Server) deltaResponse(
+	key streamKey, group string, sub *deltaSubscription, nonce string,
+) *discoveryV3.DeltaDiscoveryResponse {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	// Delta responses are resolved from the resource table rather
+	// than from a snapshot, so don't respond while the table holds
+	// changes that haven't been published. Publishing wakes the
+	// delta streams again.
+	if srv.batching || srv.syncing != nil {
+		return nil
+	}
+
+	version := srv.versionInfo
+	resources := srv.resolverFor(sub.TypeURL)(group, sub)
+
+	resp := &discoveryV3.DeltaDiscoveryResponse{
+		SystemVersionInfo: version,
+		TypeUrl:           sub.TypeURL,
+		Nonce:             nonce,
+	}
+
+	for name, r := range resources {
+		if vers, ok := sub.Sent[name]; ok && vers == r.Version {
+			continue
+		}
+
+		res := &discoveryV3.Resource{
+			Name:    name,
+			Version: r.Version,
+			Aliases: r.Aliases,
+		}
+
+		if r.Message != nil {
+			anyMessage, err := MarshalAny(r.Message)
+			if err != nil {
+				srv.log.Error(err, "failed to marshal delta resource", "name", name, "type", sub.TypeURL)
+				continue
+			}
+
+			res.Resource = anyMessage
+		}
+
+		sub.Sent[name] = r.Version
+		resp.Resources = append(resp.Resources, res)
+	}
+
+	for name := range sub.Sent {
+		if _, ok := resources[name]; !ok {
+			delete(sub.Sent, name)
+			resp.RemovedResources = append(resp.RemovedResources, name)
+		}
+	}
+
+	if sub.Responded && len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 {
+		return nil
+	}
+
+	sub.Responded = true
+	srv.stream(key, group).Sent[sub.TypeURL] = sentResponse{Nonce: nonce, Version: srv.version}
+
+	return resp
+}
+
+// resolverFor returns the delta resolver for the given type, or nil
+// if the type isn't supported on delta streams.
+func (srv *Server) resolverFor(typeURL string) deltaResolver {
+	switch typeURL {
+	case virtualHostTypeV3:
+		return func(group string, sub *deltaSubscription) map[string]deltaResource {
+			return srv.resolveVirtualHosts(group, sub.Names)
+		}
+	case resourceV3.EndpointType,
+		resourceV3.ClusterType,
+		resourceV3.RouteType,
+		resourceV3.ListenerType,
+		resourceV3.SecretType,
+		resourceV3.RuntimeType,
+		scopedRouteTypeV3:
+		return func(group string, sub *deltaSubscription) map[string]deltaResource {
+			return srv.resolveResources(typeURL, group, sub)
+		}
+	default:
+		return nil
+	}
+}
+
+// resolveResources returns the resources of the given type that are
+// published to the node group and match the subscribed names, or every
+// resource for a wildcard subscription. The version of each resource is the
+// snapshot version that last changed it, so Envoy is only sent the
+// resources that changed since it last received them. The caller must
+// hold the resource table lock.
+func (srv *Server) resolveResources(typeURL string, group string, sub *deltaSubscription) map[string]deltaResource {
+	resolved := map[string]deltaResource{}
+
+	for name, r := range srv.resources {
+		message := r.messageFor(typeURL)
+		if message == nil || !r.Nodes.Matches(group) || srv.isHeld(name) {
+			continue
+		}
+
+		envoyName := NameOf(message)
+
+		if _, ok := sub.Names[envoyName]; ok || sub.Wildcard {
+			resolved[envoyName] = deltaResource{
+				Version: strconv.FormatUint(r.Changed, 10),
+				Message: message,
+			}
+		}
+	}
+
+	return resolved
+}
+
+// wakeDeltaStreams signals every delta stream to send any changed
+// resources. The caller must hold the resource table lock.
+func (srv *Server) wakeDeltaStreams() {
+	for _, wake := range srv.deltaWatchers {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package xds
+
+import (
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	discoveryV3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSendsDeltas(t *testing.T) {
+	srv := NewServer()
+	key := streamKey{Version: EnvoyVersion3, Delta: true, ID: 1}
+
+	for _, name := range []string{"one", "two"} {
+		require.NoError(t, srv.UpdateResource(ResourceName("default/cluster/"+name),
+			ResourceVersion{Identifier: name, Version: "1"}, nil,
+			&clusterV3.Cluster{Name: name}))
+	}
+
+	sub := &deltaSubscription{
+		TypeURL:  resourceV3.ClusterType,
+		Names:    map[string]struct{}{},
+		Sent:     map[string]string{},
+		Wildcard: true,
+	}
+
+	names := func(resp *discoveryV3.DeltaDiscoveryResponse) []string {
+		var n []string
+		for _, r := range resp.GetResources() {
+			n = append(n, r.GetName())
+		}
+		return n
+	}
+
+	// The initial wildcard response contains everything.
+	resp := srv.deltaResponse(key, "", sub, "1")
+	require.NotNil(t, resp)
+	assert.ElementsMatch(t, []string{"one", "two"}, names(resp))
+
+	// Nothing changed, so there's nothing to send.
+	assert.Nil(t, srv.deltaResponse(key, "", sub, "2"))
+
+	// Only the changed resource is sent.
+	require.NoError(t, srv.UpdateResource("default/cluster/two",
+		ResourceVersion{Identifier: "two", Version: "2"}, nil,
+		&clusterV3.Cluster{Name: "two", AltStatName: "changed"}))
+
+	resp = srv.deltaResponse(key, "", sub, "3")
+	require.NotNil(t, resp)
+	assert.Equal(t, []string{"two"}, names(resp))
+	assert.Empty(t, resp.GetRemovedResources())
+
+	// Deleted resources are removed.
+	srv.DeleteResource("default/cluster/one")
+
+	resp = srv.deltaResponse(key, "", sub, "4")
+	require.NotNil(t, resp)
+	assert.Empty(t, resp.GetResources())
+	assert.Equal(t, []string{"one"}, resp.GetRemovedResources())
+
+	// Explicit subscriptions only select the named resources.
+	sub = &deltaSubscription{
+		TypeURL: resourceV3.ClusterType,
+		Names:   map[string]struct{}{"two": {}, "missing": {}},
+		Sent:    map[string]string{},
+	}
+
+	resp = srv.deltaResponse(key, "", sub, "5")
+	require.NotNil(t, resp)
+	assert.Equal(t, []string{"two"}, names(resp))
+
+	// Unsubscribing from every name doesn't make a wildcard.
+	delete(sub.Names, "two")
+	delete(sub.Names, "missing")
+
+	resp = srv.deltaResponse(key, "", sub, "6")
+	require.NotNil(t, resp)
+	assert.Empty(t, resp.GetResources())
+	assert.Equal(t, []string{"two"}, resp.GetRemovedResources())
+}
@@ -0,0 +1,245 @@
+package xds
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Change is the kind of change a Difference describes.
+type Change int
+
+const (
+	// Changed means the field is set in both messages, with
+	// different values.
+	Changed Change = iota
+
+	// Added means the field is only set in the new message.
+	Added
+
+	// Removed means the field is only set in the old message.
+	Removed
+)
+
+// Difference is a difference in a single protobuf field. Fields are
+// named by their path from the root message, using the protobuf JSON
+// field names. Old is empty if the field was added, and New is empty
+// if the field was removed.
+type Difference struct {
+	Change Change
+	Path   string
+	Old    string
+	New    string
+}
+
+func (d Difference) String() string {
+	switch d.Change {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", d.Path, d.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", d.Path, d.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", d.Path, d.Old, d.New)
+	}
+}
+
+// Diff returns the field differences between two protobuf messages.
+// Any messages of the same type are unpacked and compared field by
+// field. Differences are returned in field number order.
+func Diff(from proto.Message, to proto.Message) []Difference {
+	var diffs []Difference
+
+	diffMessage(&diffs, "", from.ProtoReflect(), to.ProtoReflect())
+
+	return diffs
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func diffMessage(diffs *[]Difference, path string, from protoreflect.Message, to protoreflect.Message) {
+	if from.Descriptor().FullName() != to.Descriptor().FullName() {
+		*diffs = append(*diffs, Difference{
+			Path: joinPath(path, "@type"),
+			Old:  strconv.Quote(string(from.Descriptor().FullName())),
+			New:  strconv.Quote(string(to.Descriptor().FullName())),
+		})
+		return
+	}
+
+	if diffAny(diffs, path, from, to) {
+		return
+	}
+
+	// Fields are declared in any order, so sort them by number.
+	fields := from.Descriptor().Fields()
+	numbered := make([]protoreflect.FieldDescriptor, fields.Len())
+
+	for i := range numbered {
+		numbered[i] = fields.Get(i)
+	}
+
+	sort.Slice(numbered, func(i, j int) bool {
+		return numbered[i].Number() < numbered[j].Number()
+	})
+
+	for _, fd := range numbered {
+		name := joinPath(path, fd.JSONName())
+
+		if !from.Has(fd) && !to.Has(fd) {
+			continue
+		}
+
+		switch {
+		case fd.IsList():
+			diffList(diffs, name, fd, from.Get(fd).List(), to.Get(fd).List())
+		case fd.IsMap():
+			diffMap(diffs, name, fd, from.Get(fd).Map(), to.Get(fd).Map())
+		default:
+			diffValue(diffs, name, fd, valueIf(from, fd), valueIf(to, fd))
+		}
+	}
+}
+
+// diffAny compares Any messages by their unpacked contents. It
+// returns false if either message is not an Any that can be unpacked.
+func diffAny(diffs *[]Difference, path string, from protoreflect.Message, to protoreflect.Message) bool {
+	fromAny, ok := from.Interface().(*Any)
+	if !ok {
+		return false
+	}
+
+	fromMessage, err := UnmarshalAny(fromAny)
+	if err != nil {
+		return false
+	}
+
+	toMessage, err := UnmarshalAny(to.Interface().(*Any))
+	if err != nil {
+		return false
+	}
+
+	diffMessage(diffs, path, fromMessage.ProtoReflect(), toMessage.ProtoReflect())
+
+	return true
+}
+
+func diffList(diffs *[]Difference, path string, fd protoreflect.FieldDescriptor, from, to protoreflect.List) {
+	for i := 0; i < from.Len() || i < to.Len(); i++ {
+		var o, n *protoreflect.Value
+
+		if i < from.Len() {
+			v := from.Get(i)
+			o = &v
+		}
+
+		if i < to.Len() {
+			v := to.Get(i)
+			n = &v
+		}
+
+		diffValue(diffs, fmt.Sprintf("%s[%d]", path, i), fd, o, n)
+	}
+}
+
+func diffMap(diffs *[]Difference, path string, fd protoreflect.FieldDescriptor, from, to protoreflect.Map) {
+	keys := map[string]protoreflect.MapKey{}
+
+	for _, m := range []protoreflect.Map{from, to} {
+		m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys[k.String()] = k
+			return true
+		})
+	}
+
+	var names []string
+	for k := range keys {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	for _, k := range names {
+		var o, n *protoreflect.Value
+
+		if from.Has(keys[k]) {
+			v := from.Get(keys[k])
+			o = &v
+		}
+
+		if to.Has(keys[k]) {
+			v := to.Get(keys[k])
+			n = &v
+		}
+
+		diffValue(diffs, fmt.Sprintf("%s[%q]", path, k), fd.MapValue(), o, n)
+	}
+}
+
+func diffValue(diffs *[]Difference, path string, fd protoreflect.FieldDescriptor, from, to *protoreflect.Value) {
+	switch {
+	case from == nil && to == nil:
+		return
+	case from == nil:
+		*diffs = append(*diffs, Difference{Change: Added, Path: path, New: formatValue(fd, *to)})
+		return
+	case to == nil:
+		*diffs = append(*diffs, Difference{Change: Removed, Path: path, Old: formatValue(fd, *from)})
+		return
+	}
+
+	if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		diffMessage(diffs, path, from.Message(), to.Message())
+		return
+	}
+
+	if o, n := formatValue(fd, *from), formatValue(fd, *to); o != n {
+		*diffs = append(*diffs, Difference{Path: path, Old: o, New: n})
+	}
+}
+
+// valueIf returns the value of the field, or nil if it is not set.
+func valueIf(m protoreflect.Message, fd protoreflect.FieldDescriptor) *protoreflect.Value {
+	if !m.Has(fd) {
+		return nil
+	}
+
+	v := m.Get(fd)
+
+	return &v
+}
+
+// formatValue formats a singular field value.
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		data, err := protojson.Marshal(v.Message().Interface())
+		if err != nil {
+			return fmt.Sprintf("<%s>", err)
+		}
+
+		return string(data)
+	case protoreflect.EnumKind:
+		if e := fd.Enum().Values().ByNumber(v.Enum()); e != nil {
+			return string(e.Name())
+		}
+
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
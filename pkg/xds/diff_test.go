@@ -0,0 +1,91 @@
+package xds
+
+import (
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listenerWithStatPrefix(t *testing.T, port uint32, prefix string) *listenerV3.Listener {
+	hcm, err := MarshalAny(&hcmV3.HttpConnectionManager{StatPrefix: prefix})
+	require.NoError(t, err)
+
+	return &listenerV3.Listener{
+		Name: "ingress",
+		Address: &coreV3.Address{
+			Address: &coreV3.Address_SocketAddress{
+				SocketAddress: &coreV3.SocketAddress{Address: "0.0.0.0",
+					PortSpecifier: &coreV3.SocketAddress_PortValue{PortValue: port}},
+			},
+		},
+		FilterChains: []*listenerV3.FilterChain{{
+			Filters: []*listenerV3.Filter{{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &listenerV3.Filter_TypedConfig{TypedConfig: hcm},
+			}},
+		}},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	from := listenerWithStatPrefix(t, 80, "ingress")
+
+	assert.Empty(t, Diff(from, listenerWithStatPrefix(t, 80, "ingress")))
+
+	to := listenerWithStatPrefix(t, 8080, "http")
+	to.FilterChains = append(to.FilterChains, &listenerV3.FilterChain{Name: "extra"})
+	to.Name = ""
+
+	diffs := Diff(from, to)
+	require.Len(t, diffs, 4)
+
+	assert.Equal(t, []string{
+		`- name: "ingress"`,
+		`~ address.socketAddress.portValue: 80 -> 8080`,
+		`~ filterChains[0].filters[0].typedConfig.statPrefix: "ingress" -> "http"`,
+	}, diffStrings(diffs[:3]))
+
+	// Added messages are shown in the protobuf JSON format.
+	assert.Equal(t, Added, diffs[3].Change)
+	assert.Equal(t, "filterChains[1]", diffs[3].Path)
+	assert.Empty(t, diffs[3].Old)
+	assert.JSONEq(t, `{"name": "extra"}`, diffs[3].New)
+
+	// Messages of different types can't be compared field by field.
+	assert.Equal(t, []string{
+		`~ @type: "envoy.config.listener.v3.Listener" -> "envoy.config.cluster.v3.Cluster"`,
+	}, diffStrings(Diff(from, &clusterV3.Cluster{})))
+
+	// Fields are compared in field number order, not declaration
+	// order.
+	assert.Equal(t, []string{
+		`+ name: "backend"`,
+		`+ altStatName: "stats"`,
+		`+ transportSocketMatches[0]: {"name":"tls"}`,
+	}, diffStrings(Diff(&clusterV3.Cluster{}, &clusterV3.Cluster{
+		Name:                   "backend",
+		AltStatName:            "stats",
+		TransportSocketMatches: []*clusterV3.Cluster_TransportSocketMatch{{Name: "tls"}},
+	})))
+}
+
+func TestDifferenceString(t *testing.T) {
+	// An empty value is a real change, not an added or removed field.
+	assert.Equal(t, "~ data:  -> AQ==", Difference{Change: Changed, Path: "data", New: "AQ=="}.String())
+	assert.Equal(t, "+ data: ", Difference{Change: Added, Path: "data"}.String())
+	assert.Equal(t, "- data: AQ==", Difference{Change: Removed, Path: "data", Old: "AQ=="}.String())
+}
+
+func diffStrings(diffs []Difference) []string {
+	var s []string
+	for _, d := range diffs {
+		s = append(s, d.String())
+	}
+
+	return s
+}
@@ -0,0 +1,98 @@
+package xds
+
+import (
+	"fmt"
+)
+
+// HoldUnresolved sets the kinds of resources that are held back from
+// Envoy until all their references resolve. By default, every kind is
+// held back, so that Envoy never sees a dangling reference. Resources
+// of other kinds are published regardless of their references.
+func (srv *Server) HoldUnresolved(kinds ...string) error {
+	known := map[string]struct{}{}
+	gated := map[string]struct{}{}
+
+	for _, k := range Kinds() {
+		known[k] = struct{}{}
+	}
+
+	for _, k := range kinds {
+		if _, ok := known[k]; !ok {
+			return fmt.Errorf("unknown resource kind %q", k)
+		}
+
+		gated[k] = struct{}{}
+	}
+
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.gated = gated
+
+	if srv.version > 0 {
+		changed = srv.publish()
+	}
+
+	return nil
+}
+
+// isHeld returns true if the named resource is being held back.
+// The caller must hold the resource table lock.
+func (srv *Server) isHeld(name ResourceName) bool {
+	_, held := srv.held[name]
+	return held
+}
+
+// holdUnresolved recalculates the set of resources that are held
+// back because their references don't resolve. It returns the names of the resources that were held or released.
+// The caller must hold the resource table lock.
+func (srv *Server) holdUnresolved() []ResourceName {
+	previous := srv.held
+	srv.held = map[ResourceName]struct{}{}
+
+	srv.references().holdUnresolved(srv.mustHold)
+
+	var toggled []ResourceName
+
+	for name := range srv.held {
+		if _, ok := previous[name]; !ok {
+			toggled = append(toggled, name)
+		}
+	}
+
+	for name := range previous {
+		// Released resources that were deleted don't need notifying.
+		if _, ok := srv.resources[name]; !ok {
+			continue
+		}
+
+		if _, ok := srv.held[name]; !ok {
+			toggled = append(toggled, name)
+		}
+	}
+
+	return toggled
+}
+
+// mustHold returns true if the resource is of a kind that is held
+// back, and has references that don't resolve. Secrets are never
+// persisted (see Persist), so a restored resource isn't held back for
+// the Secrets that it refers to until the resource source updates it.
+// The caller must hold the resource table lock.
+func (srv *Server) mustHold(r *resourceEntry, unresolved []Reference) bool {
+	if _, gated := srv.gated[keyOf(r).Kind]; !gated {
+		return false
+	}
+
+	for _, ref := range unresolved {
+		if !r.Restored || ref.Kind != "Secret" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package xds
+
+import (
+	"testing"
+
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerHoldsUnresolvedResources(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	require.NoError(t, srv.UpdateResource("default/listener/ingress",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		listenerWithRoutes(t, "ingress", "routes")))
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	// The listener is held until its routes are published.
+	assert.Empty(t, snap.GetResources(resourceV3.ListenerType))
+	assert.True(t, srv.ResourceStatus("default/listener/ingress").Held)
+
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/routes",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&routeV3.RouteConfiguration{Name: "routes"}))
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Contains(t, snap.GetResources(resourceV3.ListenerType), "ingress")
+	assert.Contains(t, snap.GetResources(resourceV3.RouteType), "routes")
+	assert.False(t, srv.ResourceStatus("default/listener/ingress").Held)
+
+	// Deleting the routes holds the listener back again.
+	srv.DeleteResource("default/routeconfiguration/routes")
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Empty(t, snap.GetResources(resourceV3.ListenerType))
+
+	// Listeners that aren't gated are published with dangling references.
+	require.NoError(t, srv.HoldUnresolved("Cluster"))
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Contains(t, snap.GetResources(resourceV3.ListenerType), "ingress")
+	assert.False(t, srv.ResourceStatus("default/listener/ingress").Held)
+
+	assert.Error(t, srv.HoldUnresolved("Bogus"))
+}
@@ -0,0 +1,180 @@
+package xds
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NameConflictError is returned when a resource has the same Envoy
+// name as an existing resource of the same kind that is published to
+// the same Envoy nodes.
+type NameConflictError struct {
+	Kind  string
+	Name  string
+	Owner ResourceName
+}
+
+func (e *NameConflictError) Error() string {
+	return fmt.Sprintf("Envoy %s %q is already defined by %s", e.Kind, e.Name, e.Owner)
+}
+
+// resourceKey is the identity of a resource as Envoy sees it.
+type resourceKey struct {
+	Kind string
+	Name string
+}
+
+// pendingEntry is a resource that is waiting for its Envoy name
+// to become available.
+type pendingEntry struct {
+	Entry    *resourceEntry
+	Sequence uint64
+}
+
+// Overlaps returns true if any node group could be selected by both selectors.
+func (n NodeSelector) Overlaps(other NodeSelector) bool {
+	if len(n) == 0 || len(other) == 0 {
+		return true
+	}
+
+	for _, g := range n {
+		if other.Matches(g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func keyOf(r *resourceEntry) resourceKey {
+	return resourceKey{
+		Kind: KindForTypename(TypeURL(r.Message)),
+		Name: NameOf(r.Message),
+	}
+}
+
+// conflictOf returns the name of the published resource that
+// prevents entry from being published as name. The caller must
+// hold the resource table lock.
+func (srv *Server) conflictOf(name ResourceName, entry *resourceEntry) (ResourceName, bool) {
+	return srv.references().conflictOf(name, entry)
+}
+
+// store publishes entry as name, updating the name index and
+// promoting any pending resources whose names become available.
+// It returns the names of the promoted resources, and of the resources
+// that refer to the stored resource. The caller must hold the resource
+// table lock.
+func (srv *Server) store(name ResourceName, entry *resourceEntry) []ResourceName {
+	previous := srv.resources[name]
+
+	if previous != nil {
+		srv.unindex(name, previous)
+	}
+
+	entry.Changed = srv.version + 1
+	srv.resources[name] = entry
+	srv.index(name, entry)
+
+	changed := srv.referrersOf(keyOf(entry))
+
+	if previous == nil {
+		return changed
+	}
+
+	changed = append(changed, srv.referrersOf(keyOf(previous))...)
+
+	return append(changed, srv.promote(keyOf(previous))...)
+}
+
+// remove unpublishes name, promoting any pending resources whose
+// names become available. It returns the names of the promoted
+// resources, and of the resources that referred to the removed
+// resource. The caller must hold the resource table lock.
+func (srv *Server) remove(name ResourceName) []ResourceName {
+	previous, ok := srv.resources[name]
+	if !ok {
+		return nil
+	}
+
+	delete(srv.resources, name)
+	srv.unindex(name, previous)
+
+	changed := srv.referrersOf(keyOf(previous))
+
+	return append(changed, srv.promote(keyOf(previous))...)
+}
+
+// promote publishes pending resources with the given key in
+// the order that they arrived, for as long as they don't conflict.
+// The caller must hold the resource table lock.
+func (srv *Server) promote(key resourceKey) []ResourceName {
+	var candidates []ResourceName
+	var promoted []ResourceName
+
+	for name, p := range srv.pending {
+		if keyOf(p.Entry) == key {
+			candidates = append(candidates, name)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return srv.pending[candidates[i]].Sequence < srv.pending[candidates[j]].Sequence
+	})
+
+	for _, name := range candidates {
+		// Skip candidates that were promoted recursively.
+		p, ok := srv.pending[name]
+		if !ok {
+			continue
+		}
+
+		entry := p.Entry
+		if _, conflict := srv.conflictOf(name, entry); conflict {
+			continue
+		}
+
+		delete(srv.pending, name)
+
+		promoted = append(promoted, name)
+		promoted = append(promoted, srv.store(name, entry)...)
+	}
+
+	return promoted
+}
+
+func (srv *Server) index(name ResourceName, entry *resourceEntry) {
+	key := keyOf(entry)
+
+	if srv.names[key] == nil {
+		srv.names[key] = map[ResourceName]struct{}{}
+	}
+
+	srv.names[key][name] = struct{}{}
+
+	for _, ref := range entry.Refs {
+		if srv.referrers[resourceKey(ref)] == nil {
+			srv.referrers[resourceKey(ref)] = map[ResourceName]struct{}{}
+		}
+
+		srv.referrers[resourceKey(ref)][name] = struct{}{}
+	}
+}
+
+func (srv *Server) unindex(name ResourceName, entry *resourceEntry) {
+	key := keyOf(entry)
+
+	delete(srv.names[key], name)
+
+	if len(srv.names[key]) == 0 {
+		delete(srv.names, key)
+	}
+
+	for _, ref := range entry.Refs {
+		delete(srv.referrers[resourceKey(ref)], name)
+
+		if len(srv.referrers[resourceKey(ref)]) == 0 {
+			delete(srv.referrers, resourceKey(ref))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package xds
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// NamingPolicy specifies how the Envoy name of a resource relates to
+// the name of the Kubernetes object that holds it.
+type NamingPolicy string
+
+const (
+	// NamingPolicyKeep keeps the Envoy name from the resource.
+	NamingPolicyKeep NamingPolicy = "keep"
+
+	// NamingPolicyForce forces the Envoy name to the qualified
+	// Kubernetes name, "namespace/name". This keeps Envoy names
+	// predictable, and prevents name collisions across namespaces.
+	NamingPolicyForce NamingPolicy = "force"
+
+	// NamingPolicyValidate requires the Envoy name to be the
+	// qualified Kubernetes name, "namespace/name".
+	NamingPolicyValidate NamingPolicy = "validate"
+)
+
+// NamingPolicies returns the names of the supported naming policies.
+func NamingPolicies() []string {
+	return []string{
+		string(NamingPolicyKeep),
+		string(NamingPolicyForce),
+		string(NamingPolicyValidate),
+	}
+}
+
+// ParseNamingPolicy parses the name of a naming policy.
+func ParseNamingPolicy(s string) (NamingPolicy, error) {
+	for _, p := range NamingPolicies() {
+		if s == p {
+			return NamingPolicy(s), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown naming policy %q", s)
+}
+
+// Apply applies the naming policy to the message, which must be a
+// message that the caller owns, since NamingPolicyForce modifies it.
+// The Envoy name of a VirtualHost is interpreted by VHDS, so virtual
+// hosts are exempt from the naming policy.
+func (p NamingPolicy) Apply(message proto.Message, qualifiedName string) error {
+	if KindForTypename(TypeURL(message)) == "VirtualHost" {
+		return nil
+	}
+
+	switch p {
+	case NamingPolicyForce:
+		if !SetName(message, qualifiedName) {
+			return fmt.Errorf("%s has no name field", message.ProtoReflect().Descriptor().FullName())
+		}
+	case NamingPolicyValidate:
+		if name := NameOf(message); name != qualifiedName {
+			return fmt.Errorf("name %q does not match %q", name, qualifiedName)
+		}
+	}
+
+	return nil
+}
+
+// SetName sets the name of the given message, returning false if it
+// has no name field. The name field is found in the same way as NameOf.
+func SetName(message proto.Message, name string) bool {
+	m := message.ProtoReflect()
+
+	for _, f := range []protoreflect.Name{"name", "cluster_name"} {
+		field := m.Descriptor().Fields().ByName(f)
+		if field != nil && field.Kind() == protoreflect.StringKind && !field.IsList() {
+			m.Set(field, protoreflect.ValueOfString(name))
+			return true
+		}
+	}
+
+	return false
+}
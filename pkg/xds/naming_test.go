@@ -0,0 +1,37 @@
+package xds
+
+import (
+	"testing"
+
+	endpointV3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingPolicy(t *testing.T) {
+	listener := &listenerV3.Listener{Name: "ingress"}
+
+	assert.NoError(t, NamingPolicyKeep.Apply(listener, "default/ingress"))
+	assert.Equal(t, "ingress", listener.GetName())
+
+	assert.Error(t, NamingPolicyValidate.Apply(listener, "default/ingress"))
+
+	assert.NoError(t, NamingPolicyForce.Apply(listener, "default/ingress"))
+	assert.Equal(t, "default/ingress", listener.GetName())
+
+	assert.NoError(t, NamingPolicyValidate.Apply(listener, "default/ingress"))
+
+	// Load assignments are named by their cluster name.
+	endpoints := &endpointV3.ClusterLoadAssignment{ClusterName: "backend"}
+	assert.NoError(t, NamingPolicyForce.Apply(endpoints, "default/backend"))
+	assert.Equal(t, "default/backend", endpoints.GetClusterName())
+
+	// Virtual host names are exempt.
+	vhost := &routeV3.VirtualHost{Name: "routes/www"}
+	assert.NoError(t, NamingPolicyForce.Apply(vhost, "default/www"))
+	assert.Equal(t, "routes/www", vhost.GetName())
+
+	_, err := ParseNamingPolicy("bogus")
+	assert.Error(t, err)
+}
@@ -0,0 +1,361 @@
+package xds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
+)
+
+// persistFormat is the version of the persisted snapshot format.
+const persistFormat = 2
+
+// persistedSnapshot is the file format of a persisted snapshot. The
+// checksum is the SHA-256 digest of the contents JSON, so that a
+// truncated or corrupt file is never served to Envoy.
+type persistedSnapshot struct {
+	Format   int             `json:"format"`
+	Version  string          `json:"version"`
+	Checksum string          `json:"checksum"`
+	Contents json.RawMessage `json:"contents"`
+}
+
+// persistedContents is the contents of a persisted snapshot. The node
+// groups are the groups that the snapshot was published to.
+type persistedContents struct {
+	Groups    []string            `json:"groups"`
+	Resources []persistedResource `json:"resources"`
+}
+
+// persistedResource is a resource in a persisted snapshot.
+type persistedResource struct {
+	Name       ResourceName `json:"name"`
+	Identifier string       `json:"identifier"`
+	Version    string       `json:"version"`
+	Nodes      NodeSelector `json:"nodes,omitempty"`
+	TypeURL    string       `json:"typeUrl"`
+	Value      []byte       `json:"value"`
+}
+
+// persistDelay is how long the snapshot writer waits before writing,
+// so that a burst of updates is written once.
+const persistDelay = time.Second
+
+// snapshotCopy is a copy of the published resources that the snapshot
+// writer persists outside of the resource table lock.
+type snapshotCopy struct {
+	Version   string
+	Groups    []string
+	Resources map[ResourceName]resourceEntry
+}
+
+// snapshotWriter persists snapshots in the background. Only the latest
+// snapshot is written, so that writes are coalesced.
+type snapshotWriter struct {
+	path string
+	log  logr.Logger
+
+	// kick wakes the writer goroutine. Closing it stops the
+	// goroutine once the latest snapshot is written.
+	kick chan struct{}
+
+	// writeLock serializes writes, so that an older snapshot
+	// never replaces a newer one.
+	writeLock sync.Mutex
+
+	lock sync.Mutex
+	next *snapshotCopy
+}
+
+// newSnapshotWriter starts a writer that persists snapshots to path.
+func newSnapshotWriter(path string, log logr.Logger) *snapshotWriter {
+	w := &snapshotWriter{
+		path: path,
+		log:  log,
+		kick: make(chan struct{}, 1),
+	}
+
+	go func() {
+		for range w.kick {
+			time.Sleep(persistDelay)
+			w.flush()
+		}
+
+		w.flush()
+	}()
+
+	return w
+}
+
+// queue replaces the snapshot that is waiting to be written.
+func (w *snapshotWriter) queue(snap *snapshotCopy) {
+	w.lock.Lock()
+	w.next = snap
+	w.lock.Unlock()
+
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// flush writes the snapshot that is waiting to be written, if any.
+func (w *snapshotWriter) flush() {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	w.lock.Lock()
+	snap := w.next
+	w.next = nil
+	w.lock.Unlock()
+
+	if snap == nil {
+		return
+	}
+
+	if err := writeSnapshot(w.path, snap); err != nil {
+		w.log.Error(err, "failed to persist snapshot", "path", w.path)
+	}
+}
+
+// Persist sets the file that the server writes the published
+// resources to each time it publishes a snapshot, so that a restarted
+// server can restore them (see Restore). Snapshots are written in the
+// background, and a burst of snapshots is written once (see Flush).
+// Secrets are never written, so that private keys don't end up on
+// disk. Persistence is disabled if the path is empty.
+func (srv *Server) Persist(path string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.persister != nil {
+		close(srv.persister.kick)
+		srv.persister = nil
+	}
+
+	if path != "" {
+		srv.persister = newSnapshotWriter(path, srv.log)
+	}
+}
+
+// Flush writes the last published snapshot to the persist file if it
+// hasn't been written yet. Call Flush before exiting, so that the
+// last snapshot isn't lost.
+func (srv *Server) Flush() {
+	srv.lock.Lock()
+	w := srv.persister
+	srv.lock.Unlock()
+
+	if w != nil {
+		w.flush()
+	}
+}
+
+// persist queues a copy of the published resources to be written to
+// the persist file. The caller must hold the resource table lock.
+func (srv *Server) persist() {
+	if srv.persister == nil {
+		return
+	}
+
+	snap := &snapshotCopy{
+		Version:   srv.versionInfo,
+		Groups:    make([]string, 0, len(srv.groups)),
+		Resources: make(map[ResourceName]resourceEntry, len(srv.resources)),
+	}
+
+	for g := range srv.groups {
+		snap.Groups = append(snap.Groups, g)
+	}
+
+	// Stored messages are never modified, so the copy can
+	// share them.
+	for name, r := range srv.resources {
+		if KindForTypename(TypeURL(r.Message)) != "Secret" {
+			snap.Resources[name] = resourceEntry{Version: r.Version, Nodes: r.Nodes, Message: r.Message}
+		}
+	}
+
+	srv.persister.queue(snap)
+}
+
+// writeSnapshot atomically replaces the named file with the snapshot.
+func writeSnapshot(path string, snap *snapshotCopy) error {
+	resources := make([]persistedResource, 0, len(snap.Resources))
+
+	for name, r := range snap.Resources {
+		a, err := MarshalAny(r.Message)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+
+		resources = append(resources, persistedResource{
+			Name:       name,
+			Identifier: r.Version.Identifier,
+			Version:    r.Version.Version,
+			Nodes:      r.Nodes,
+			TypeURL:    a.GetTypeUrl(),
+			Value:      a.GetValue(),
+		})
+	}
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	sort.Strings(snap.Groups)
+
+	data, err := json.Marshal(persistedContents{Groups: snap.Groups, Resources: resources})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+
+	data, err = json.Marshal(persistedSnapshot{
+		Format:   persistFormat,
+		Version:  snap.Version,
+		Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+		Contents: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // nolint(errcheck)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() // nolint(errcheck)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readSnapshot reads and verifies a persisted snapshot.
+func readSnapshot(path string) (*persistedSnapshot, *persistedContents, error) {
+	data, err := ioutil.ReadFile(path) // nolint(gosec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snap persistedSnapshot
+
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&snap); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	if snap.Format != persistFormat {
+		return nil, nil, fmt.Errorf("unsupported snapshot format %d", snap.Format)
+	}
+
+	sum := sha256.Sum256(snap.Contents)
+	if snap.Checksum != "sha256:"+hex.EncodeToString(sum[:]) {
+		return nil, nil, errors.New("snapshot checksum mismatch")
+	}
+
+	var contents persistedContents
+
+	if err := json.Unmarshal(snap.Contents, &contents); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot contents: %w", err)
+	}
+
+	return &snap, &contents, nil
+}
+
+// Restore publishes the resources from a persisted snapshot, with the
+// version that they were originally published with. Until the resource
+// source has synced, the server keeps serving the restored snapshot to
+// Envoy, and holds back the updates that it receives, so that a
+// restarted controller never serves a partial configuration (see
+// HoldUntilSynced and MarkSynced). Restore must be called before any
+// resources are updated. It is not an error if the file does not exist.
+func (srv *Server) Restore(path string) error {
+	snap, contents, err := readSnapshot(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	// Decode everything first, so that we never restore a
+	// partial snapshot.
+	messages := make([]proto.Message, len(contents.Resources))
+
+	for i, r := range contents.Resources {
+		message, err := UnmarshalAny(&Any{TypeUrl: r.TypeURL, Value: r.Value})
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", r.Name, err)
+		}
+
+		messages[i] = message
+	}
+
+	srv.lock.Lock()
+
+	// Continue the numbering of unlabelled versions, so that
+	// they don't collide with the restored version.
+	if vers, err := strconv.ParseUint(snap.Version, 10, 64); err == nil && vers > 0 {
+		srv.version = vers - 1
+	}
+
+	// Serve the restored snapshot to the node groups that it
+	// was published to, since they may reconnect before the
+	// resource source syncs.
+	for _, g := range contents.Groups {
+		srv.groups[g] = struct{}{}
+	}
+
+	srv.lock.Unlock()
+
+	err = srv.Batch(snap.Version, func() error {
+		for i, r := range contents.Resources {
+			vers := ResourceVersion{Identifier: r.Identifier, Version: r.Version}
+			if err := srv.UpdateResource(r.Name, vers, r.Nodes, messages[i]); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", r.Name, err)
+			}
+
+			// Mark the resource before the batch publishes,
+			// since restored resources aren't held back for
+			// the Secrets that weren't persisted.
+			srv.lock.Lock()
+
+			if entry, ok := srv.resources[r.Name]; ok {
+				entry.Restored = true
+			}
+
+			srv.lock.Unlock()
+		}
+
+		return nil
+	})
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.holdUntilSynced()
+
+	srv.log.Info("restored snapshot", "path", path, "version", snap.Version, "resources", len(contents.Resources))
+
+	return err
+}
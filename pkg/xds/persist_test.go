@@ -0,0 +1,149 @@
+package xds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRestoresSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persist")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.json")
+
+	// A missing snapshot is not an error.
+	require.NoError(t, NewServer().Restore(path))
+
+	srv := NewServer()
+	srv.observeNodeGroup("edge")
+	srv.Persist(path)
+
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"}))
+	require.NoError(t, srv.UpdateResource("default/cluster/two",
+		ResourceVersion{Identifier: "2", Version: "1"}, NodeSelector{"edge"},
+		&clusterV3.Cluster{Name: "two"}))
+
+	// Snapshots are written in the background.
+	srv.Flush()
+
+	// The restored snapshot is served to the node groups that it
+	// was published to, with its original version.
+	srv = NewServer()
+	require.NoError(t, srv.Restore(path))
+
+	snap, err := srv.cacheV3.GetSnapshot("edge")
+	require.NoError(t, err)
+	assert.Equal(t, "2", snap.GetVersion(resourceV3.ClusterType))
+	assert.Len(t, snap.GetResources(resourceV3.ClusterType), 2)
+
+	// Updates are held back until the restore ends.
+	require.NoError(t, srv.UpdateResource("default/cluster/three",
+		ResourceVersion{Identifier: "3", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "three"}))
+
+	snap, err = srv.cacheV3.GetSnapshot("edge")
+	require.NoError(t, err)
+	assert.Len(t, snap.GetResources(resourceV3.ClusterType), 2)
+
+	// New node groups aren't served the partially updated table.
+	srv.observeNodeGroup("mesh")
+
+	_, err = srv.cacheV3.GetSnapshot("mesh")
+	assert.Error(t, err)
+
+	// The restore ends when the source has handled every current
+	// resource, and restored resources that no longer exist are
+	// removed.
+	srv.MarkSynced([]ResourceName{"default/cluster/one", "default/cluster/three"})
+
+	assert.False(t, srv.Synced())
+
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"}))
+
+	assert.True(t, srv.Synced())
+
+	snap, err = srv.cacheV3.GetSnapshot("edge")
+	require.NoError(t, err)
+	assert.Equal(t, "3", snap.GetVersion(resourceV3.ClusterType))
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "one")
+	assert.NotContains(t, snap.GetResources(resourceV3.ClusterType), "two")
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "three")
+
+	snap, err = srv.cacheV3.GetSnapshot("mesh")
+	require.NoError(t, err)
+	assert.Equal(t, "3", snap.GetVersion(resourceV3.ClusterType))
+
+	// A corrupt snapshot is rejected.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(string(data), "one", "uno", 1)), 0600))
+
+	assert.EqualError(t, NewServer().Restore(path), "snapshot checksum mismatch")
+}
+
+func TestServerDoesNotPersistSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persist")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.json")
+
+	srv := NewServer()
+	srv.observeNodeGroup("edge")
+	srv.Persist(path)
+
+	tls, err := MarshalAny(&tlsV3.UpstreamTlsContext{
+		CommonTlsContext: &tlsV3.CommonTlsContext{
+			TlsCertificateSdsSecretConfigs: []*tlsV3.SdsSecretConfig{
+				{Name: "cert", SdsConfig: adsConfigSource()},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, srv.UpdateResource("default/secret/cert",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&tlsV3.Secret{Name: "cert"}))
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{
+			Name: "one",
+			TransportSocket: &coreV3.TransportSocket{
+				Name:       "envoy.transport_sockets.tls",
+				ConfigType: &coreV3.TransportSocket_TypedConfig{TypedConfig: tls},
+			},
+		}))
+
+	srv.Flush()
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "default/secret/cert")
+
+	srv = NewServer()
+	require.NoError(t, srv.Restore(path))
+
+	snap, err := srv.cacheV3.GetSnapshot("edge")
+	require.NoError(t, err)
+	assert.Empty(t, snap.GetResources(resourceV3.SecretType))
+
+	// The restored cluster is served without its secret.
+	assert.Len(t, snap.GetResources(resourceV3.ClusterType), 1)
+}
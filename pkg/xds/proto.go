@@ -4,7 +4,9 @@ import (
 	protov1 "github.com/golang/protobuf/proto" // nolint(staticcheck)
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // Any ...
@@ -36,6 +38,50 @@ func UnmarshalAny(anyMessage *Any) (proto.Message, error) {
 	return ProtoV2(x.Message), nil
 }
 
+// MarshalJSON marshals a message into the protobuf JSON form of an
+// Any, which names the message type in the "@type" field.
+func MarshalJSON(message proto.Message) ([]byte, error) {
+	anyMessage, err := MarshalAny(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return protojson.Marshal(ProtoV2(anyMessage))
+}
+
+// UnmarshalJSON unmarshals a message from the protobuf JSON form of
+// an Any. The message type must be registered.
+func UnmarshalJSON(data []byte) (proto.Message, error) {
+	var anyMessage Any
+
+	if err := protojson.Unmarshal(data, ProtoV2(&anyMessage)); err != nil {
+		return nil, err
+	}
+
+	return UnmarshalAny(&anyMessage)
+}
+
+// TypeURL returns the any.Any type URL for the given message.
+func TypeURL(message proto.Message) string {
+	return "type.googleapis.com/" + string(message.ProtoReflect().Descriptor().FullName())
+}
+
+// NameOf returns the Envoy resource name of the message. This is
+// the "name" field for most resources, and the "cluster_name" field
+// for ClusterLoadAssignment resources.
+func NameOf(message proto.Message) string {
+	m := message.ProtoReflect()
+
+	for _, f := range []protoreflect.Name{"name", "cluster_name"} {
+		field := m.Descriptor().Fields().ByName(f)
+		if field != nil && field.Kind() == protoreflect.StringKind && !field.IsList() {
+			return m.Get(field).String()
+		}
+	}
+
+	return ""
+}
+
 // Validate calls the `Validate` method of the proto.Message, if it has one.
 func Validate(message proto.Message) error {
 	if v, ok := interface{}(message).(interface{ Validate() error }); ok {
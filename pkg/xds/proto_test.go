@@ -0,0 +1,25 @@
+package xds
+
+import (
+	"testing"
+
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	listener := &listenerV3.Listener{Name: "ingress"}
+
+	data, err := MarshalJSON(listener)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"@type":"type.googleapis.com/envoy.config.listener.v3.Listener"`)
+
+	message, err := UnmarshalJSON(data)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(listener, message))
+
+	_, err = UnmarshalJSON([]byte(`{"name": "ingress"}`))
+	assert.Error(t, err)
+}
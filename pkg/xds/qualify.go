@@ -0,0 +1,139 @@
+package xds
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// qualifiedFields maps messages to the string fields that refer to
+// other resources by their Envoy name.
+var qualifiedFields = map[protoreflect.FullName][]protoreflect.Name{
+	// RDS route configurations.
+	"envoy.config.filter.network.http_connection_manager.v2.Rds":      {"route_config_name"},
+	"envoy.extensions.filters.network.http_connection_manager.v3.Rds": {"route_config_name"},
+
+	// SRDS scopes.
+	"envoy.api.v2.ScopedRouteConfiguration":          {"route_configuration_name"},
+	"envoy.config.route.v3.ScopedRouteConfiguration": {"route_configuration_name"},
+
+	// EDS endpoints.
+	"envoy.api.v2.Cluster.EdsClusterConfig":            {"service_name"},
+	"envoy.config.cluster.v3.Cluster.EdsClusterConfig": {"service_name"},
+
+	// SDS secrets.
+	"envoy.api.v2.auth.SdsSecretConfig":                         {"name"},
+	"envoy.extensions.transport_sockets.tls.v3.SdsSecretConfig": {"name"},
+
+	// Route and TCP proxy clusters.
+	"envoy.api.v2.route.RouteAction":                                                       {"cluster"},
+	"envoy.api.v2.route.WeightedCluster.ClusterWeight":                                     {"name"},
+	"envoy.config.route.v3.RouteAction":                                                    {"cluster"},
+	"envoy.config.route.v3.WeightedCluster.ClusterWeight":                                  {"name"},
+	"envoy.config.filter.network.tcp_proxy.v2.TcpProxy":                                    {"cluster"},
+	"envoy.config.filter.network.tcp_proxy.v2.TcpProxy.WeightedCluster.ClusterWeight":      {"name"},
+	"envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy":                               {"cluster"},
+	"envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy.WeightedCluster.ClusterWeight": {"name"},
+}
+
+// QualifyNames qualifies the names that message uses to refer to
+// other resources with namespace, so that "name" becomes
+// "namespace/name". Names that already contain a "/" are assumed to be
+// qualified, and names of resources that Envoy doesn't fetch from this
+// server are left alone. References from messages embedded in Any fields are
+// qualified too. If any names were qualified, QualifyNames returns a
+// modified copy of message, otherwise it returns message.
+func QualifyNames(message proto.Message, namespace string) proto.Message {
+	if namespace == "" {
+		return message
+	}
+
+	qualified := proto.Clone(message)
+	if !qualifyNames(qualified.ProtoReflect(), namespace) {
+		return message
+	}
+
+	return qualified
+}
+
+func qualifyNames(m protoreflect.Message, namespace string) bool {
+	if a, ok := m.Interface().(*Any); ok {
+		// Skip embedded messages that we don't know about.
+		embedded, err := UnmarshalAny(a)
+		if err != nil || !qualifyNames(embedded.ProtoReflect(), namespace) {
+			return false
+		}
+
+		repacked, err := MarshalAny(embedded)
+		if err != nil {
+			return false
+		}
+
+		a.Value = repacked.GetValue()
+
+		return true
+	}
+
+	changed := false
+
+	if servedHere(m) {
+		for _, name := range qualifiedFields[m.Descriptor().FullName()] {
+			field := m.Descriptor().Fields().ByName(name)
+
+			if value := m.Get(field).String(); value != "" && !strings.Contains(value, "/") {
+				m.Set(field, protoreflect.ValueOfString(namespace+"/"+value))
+				changed = true
+			}
+		}
+	}
+
+	m.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() != protoreflect.MessageKind && field.Kind() != protoreflect.GroupKind {
+			return true
+		}
+
+		switch {
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				changed = qualifyNames(list.Get(i).Message(), namespace) || changed
+			}
+		case field.IsMap():
+			if field.MapValue().Kind() == protoreflect.MessageKind {
+				value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					changed = qualifyNames(v.Message(), namespace) || changed
+					return true
+				})
+			}
+		default:
+			changed = qualifyNames(value.Message(), namespace) || changed
+		}
+
+		return true
+	})
+
+	return changed
+}
+
+// namespaceOf returns the namespace part of a resource name.
+func namespaceOf(name ResourceName) string {
+	if i := strings.Index(string(name), "/"); i > 0 {
+		return string(name[:i])
+	}
+
+	return ""
+}
+
+// QualifyReferences sets whether the server qualifies the references
+// in each updated resource with the namespace of the resource (see
+// QualifyNames). This lets resources in different namespaces use the
+// same short names without colliding, as long as the resources are
+// named with their qualified name too (see NamingPolicyForce).
+// It applies to subsequent resource updates.
+func (srv *Server) QualifyReferences(enable bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.qualify = enable
+}
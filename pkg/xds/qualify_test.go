@@ -0,0 +1,100 @@
+package xds
+
+import (
+	"testing"
+
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tlsV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestQualifyNames(t *testing.T) {
+	listener := listenerWithRoutes(t, "ingress", "routes")
+	qualified := QualifyNames(listener, "team")
+
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "team/routes"}},
+		ReferencesOf(qualified))
+
+	// The original message is not modified.
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "routes"}},
+		ReferencesOf(listener))
+
+	// Qualified names are left alone.
+	listener = listenerWithRoutes(t, "ingress", "other/routes")
+	assert.Same(t, listener, QualifyNames(listener, "team"))
+
+	routes := &routeV3.RouteConfiguration{
+		Name: "routes",
+		VirtualHosts: []*routeV3.VirtualHost{{
+			Name:    "default",
+			Domains: []string{"*"},
+			Routes: []*routeV3.Route{{
+				Action: &routeV3.Route_Route{Route: &routeV3.RouteAction{
+					ClusterSpecifier: &routeV3.RouteAction_Cluster{Cluster: "backend"},
+				}},
+			}, {
+				Action: &routeV3.Route_Route{Route: &routeV3.RouteAction{
+					ClusterSpecifier: &routeV3.RouteAction_WeightedClusters{
+						WeightedClusters: &routeV3.WeightedCluster{
+							Clusters: []*routeV3.WeightedCluster_ClusterWeight{
+								{Name: "blue"},
+								{Name: "other/green"},
+							},
+						},
+					},
+				}},
+			}},
+		}},
+	}
+
+	qualified = QualifyNames(routes, "team")
+	require.IsType(t, &routeV3.RouteConfiguration{}, qualified)
+
+	vhost := qualified.(*routeV3.RouteConfiguration).GetVirtualHosts()[0]
+	assert.Equal(t, "routes", qualified.(*routeV3.RouteConfiguration).GetName())
+	assert.Equal(t, "team/backend", vhost.GetRoutes()[0].GetRoute().GetCluster())
+
+	weighted := vhost.GetRoutes()[1].GetRoute().GetWeightedClusters().GetClusters()
+	assert.Equal(t, "team/blue", weighted[0].GetName())
+	assert.Equal(t, "other/green", weighted[1].GetName())
+
+	assert.Same(t, proto.Message(routes), QualifyNames(routes, ""))
+
+	// Static secrets are not qualified.
+	tls := &tlsV3.CommonTlsContext{
+		TlsCertificateSdsSecretConfigs: []*tlsV3.SdsSecretConfig{
+			{Name: "cert", SdsConfig: adsConfigSource()},
+			{Name: "static"},
+		},
+	}
+
+	qualified = QualifyNames(tls, "team")
+	require.IsType(t, &tlsV3.CommonTlsContext{}, qualified)
+
+	secrets := qualified.(*tlsV3.CommonTlsContext).GetTlsCertificateSdsSecretConfigs()
+	assert.Equal(t, "team/cert", secrets[0].GetName())
+	assert.Equal(t, "static", secrets[1].GetName())
+}
+
+func TestServerQualifiesReferences(t *testing.T) {
+	srv := NewServer()
+	srv.QualifyReferences(true)
+
+	require.NoError(t, srv.UpdateResource("team/listener/ingress",
+		ResourceVersion{Identifier: "ingress", Version: "1"}, nil,
+		listenerWithRoutes(t, "team/ingress", "routes")))
+
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "team/routes"}},
+		srv.UnresolvedReferences("team/listener/ingress"))
+
+	require.NoError(t, srv.UpdateResource("team/routeconfiguration/routes",
+		ResourceVersion{Identifier: "routes", Version: "1"}, nil,
+		&routeV3.RouteConfiguration{Name: "team/routes"}))
+
+	assert.Empty(t, srv.UnresolvedReferences("team/listener/ingress"))
+}
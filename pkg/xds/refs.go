@@ -0,0 +1,226 @@
+package xds
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Reference is a reference from one Envoy resource to another by
+// its Envoy name.
+type Reference struct {
+	Kind string
+	Name string
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%s %q", r.Kind, r.Name)
+}
+
+// configSourceFields maps the messages that name resources that Envoy
+// fetches with xDS to the ConfigSource field that says where Envoy
+// fetches them from.
+var configSourceFields = map[protoreflect.FullName]protoreflect.Name{
+	"envoy.config.filter.network.http_connection_manager.v2.Rds":      "config_source",
+	"envoy.extensions.filters.network.http_connection_manager.v3.Rds": "config_source",
+	"envoy.api.v2.Cluster.EdsClusterConfig":                           "eds_config",
+	"envoy.config.cluster.v3.Cluster.EdsClusterConfig":                "eds_config",
+	"envoy.api.v2.auth.SdsSecretConfig":                               "sds_config",
+	"envoy.extensions.transport_sockets.tls.v3.SdsSecretConfig":       "sds_config",
+}
+
+// servedHere returns false if m names a resource that Envoy fetches
+// from somewhere other than this server. Envoy fetches resources from
+// this server if their ConfigSource is aggregated (ADS), or is "self"
+// (the server that served m). Resources with other config sources
+// come from other management servers or from files, and SDS secrets
+// without a config source are static secrets in the Envoy bootstrap.
+func servedHere(m protoreflect.Message) bool {
+	name, ok := configSourceFields[m.Descriptor().FullName()]
+	if !ok {
+		return true
+	}
+
+	field := m.Descriptor().Fields().ByName(name)
+	if !m.Has(field) {
+		return false
+	}
+
+	source := m.Get(field).Message()
+
+	for _, specifier := range []protoreflect.Name{"ads", "self"} {
+		if f := source.Descriptor().Fields().ByName(specifier); f != nil && source.Has(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// referenceField returns a referenceFunc that refers to a resource of
+// the given kind by the named string field.
+func referenceField(kind string, field protoreflect.Name) referenceFunc {
+	return func(m protoreflect.Message) []Reference {
+		f := m.Descriptor().Fields().ByName(field)
+		if name := m.Get(f).String(); name != "" {
+			return []Reference{{Kind: kind, Name: name}}
+		}
+
+		return nil
+	}
+}
+
+// referenceEndpoints refers to the ClusterLoadAssignment of an EDS
+// cluster, which is named by the EDS service name, if there is one,
+// or else by the cluster name.
+func referenceEndpoints(m protoreflect.Message) []Reference {
+	fields := m.Descriptor().Fields()
+
+	eds := fields.ByName("eds_cluster_config")
+	if !m.Has(eds) {
+		return nil
+	}
+
+	config := m.Get(eds).Message()
+	if !servedHere(config) {
+		return nil
+	}
+
+	if service := config.Get(eds.Message().Fields().ByName("service_name")).String(); service != "" {
+		return []Reference{{Kind: "ClusterLoadAssignment", Name: service}}
+	}
+
+	return []Reference{{Kind: "ClusterLoadAssignment", Name: m.Get(fields.ByName("name")).String()}}
+}
+
+// referenceFunc returns the references held by a message.
+type referenceFunc func(protoreflect.Message) []Reference
+
+// referenceFuncs maps the messages that refer to other resources
+// to functions that extract the references.
+var referenceFuncs = map[protoreflect.FullName]referenceFunc{
+	// RDS route configurations.
+	"envoy.config.filter.network.http_connection_manager.v2.Rds":      referenceField("RouteConfiguration", "route_config_name"),
+	"envoy.extensions.filters.network.http_connection_manager.v3.Rds": referenceField("RouteConfiguration", "route_config_name"),
+
+	// SRDS scopes.
+	"envoy.api.v2.ScopedRouteConfiguration":          referenceField("RouteConfiguration", "route_configuration_name"),
+	"envoy.config.route.v3.ScopedRouteConfiguration": referenceField("RouteConfiguration", "route_configuration_name"),
+
+	// EDS endpoints.
+	"envoy.api.v2.Cluster":            referenceEndpoints,
+	"envoy.config.cluster.v3.Cluster": referenceEndpoints,
+
+	// SDS secrets.
+	"envoy.api.v2.auth.SdsSecretConfig":                         referenceField("Secret", "name"),
+	"envoy.extensions.transport_sockets.tls.v3.SdsSecretConfig": referenceField("Secret", "name"),
+}
+
+// ReferencesOf returns the resources that message refers to by name,
+// including references from messages embedded in Any fields (e.g.
+// filter and transport socket configurations). Only references to
+// resources that Envoy fetches from this server are returned (see
+// servedHere).
+func ReferencesOf(message proto.Message) []Reference {
+	refs := map[Reference]struct{}{}
+
+	collectReferences(message.ProtoReflect(), refs)
+
+	result := make([]Reference, 0, len(refs))
+	for r := range refs {
+		result = append(result, r)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func collectReferences(m protoreflect.Message, refs map[Reference]struct{}) {
+	if a, ok := m.Interface().(*Any); ok {
+		// Skip embedded messages that we don't know about.
+		if embedded, err := UnmarshalAny(a); err == nil {
+			collectReferences(embedded.ProtoReflect(), refs)
+		}
+
+		return
+	}
+
+	if f, ok := referenceFuncs[m.Descriptor().FullName()]; ok && servedHere(m) {
+		for _, r := range f(m) {
+			refs[r] = struct{}{}
+		}
+	}
+
+	m.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() != protoreflect.MessageKind && field.Kind() != protoreflect.GroupKind {
+			return true
+		}
+
+		switch {
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				collectReferences(list.Get(i).Message(), refs)
+			}
+		case field.IsMap():
+			if field.MapValue().Kind() == protoreflect.MessageKind {
+				value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					collectReferences(v.Message(), refs)
+					return true
+				})
+			}
+		default:
+			collectReferences(value.Message(), refs)
+		}
+
+		return true
+	})
+}
+
+// UnresolvedReferences returns the references from the named
+// resource to resources that are not published to every Envoy node
+// group that the named resource is published to.
+func (srv *Server) UnresolvedReferences(name ResourceName) []Reference {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	r, ok := srv.resources[name]
+	if !ok {
+		return nil
+	}
+
+	return srv.unresolved(r)
+}
+
+// unresolved returns the references from entry that don't resolve.
+// The caller must hold the resource table lock.
+func (srv *Server) unresolved(entry *resourceEntry) []Reference {
+	return srv.references().unresolved(entry)
+}
+
+// references returns the view of the resource table that references
+// are resolved against. The caller must hold the resource table lock.
+func (srv *Server) references() referenceTable {
+	return referenceTable{Resources: srv.resources, Names: srv.names, Held: srv.held}
+}
+
+// referrersOf returns the names of the resources that refer to key.
+// The caller must hold the resource table lock.
+func (srv *Server) referrersOf(key resourceKey) []ResourceName {
+	var names []ResourceName
+
+	for name := range srv.referrers[key] {
+		names = append(names, name)
+	}
+
+	return names
+}
@@ -0,0 +1,162 @@
+package xds
+
+import (
+	"sync"
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointV3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcmV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tlsV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adsConfigSource() *coreV3.ConfigSource {
+	return &coreV3.ConfigSource{
+		ConfigSourceSpecifier: &coreV3.ConfigSource_Ads{Ads: &coreV3.AggregatedConfigSource{}},
+	}
+}
+
+func listenerWithRoutes(t *testing.T, name string, routes string) *listenerV3.Listener {
+	return listenerWithRds(t, name, &hcmV3.Rds{RouteConfigName: routes, ConfigSource: adsConfigSource()})
+}
+
+func listenerWithRds(t *testing.T, name string, rds *hcmV3.Rds) *listenerV3.Listener {
+	hcm, err := MarshalAny(&hcmV3.HttpConnectionManager{
+		StatPrefix:     name,
+		RouteSpecifier: &hcmV3.HttpConnectionManager_Rds{Rds: rds},
+	})
+	require.NoError(t, err)
+
+	return &listenerV3.Listener{
+		Name: name,
+		FilterChains: []*listenerV3.FilterChain{{
+			Filters: []*listenerV3.Filter{{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &listenerV3.Filter_TypedConfig{TypedConfig: hcm},
+			}},
+		}},
+	}
+}
+
+func TestReferencesOf(t *testing.T) {
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "routes"}},
+		ReferencesOf(listenerWithRoutes(t, "ingress", "routes")))
+
+	tls, err := MarshalAny(&tlsV3.UpstreamTlsContext{
+		CommonTlsContext: &tlsV3.CommonTlsContext{
+			TlsCertificateSdsSecretConfigs: []*tlsV3.SdsSecretConfig{
+				{Name: "cert", SdsConfig: adsConfigSource()},
+				// A static secret from the Envoy bootstrap.
+				{Name: "static"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		[]Reference{
+			{Kind: "ClusterLoadAssignment", Name: "backend"},
+			{Kind: "Secret", Name: "cert"},
+		},
+		ReferencesOf(&clusterV3.Cluster{
+			Name:             "backend",
+			EdsClusterConfig: &clusterV3.Cluster_EdsClusterConfig{EdsConfig: adsConfigSource()},
+			TransportSocket: &coreV3.TransportSocket{
+				Name:       "envoy.transport_sockets.tls",
+				ConfigType: &coreV3.TransportSocket_TypedConfig{TypedConfig: tls},
+			},
+		}))
+
+	assert.Equal(t,
+		[]Reference{{Kind: "ClusterLoadAssignment", Name: "service"}},
+		ReferencesOf(&clusterV3.Cluster{
+			Name: "backend",
+			EdsClusterConfig: &clusterV3.Cluster_EdsClusterConfig{
+				ServiceName: "service",
+				EdsConfig: &coreV3.ConfigSource{
+					ConfigSourceSpecifier: &coreV3.ConfigSource_Self{Self: &coreV3.SelfConfigSource{}},
+				},
+			},
+		}))
+
+	// Resources from other management servers or from files are not
+	// references to this server.
+	assert.Empty(t, ReferencesOf(&clusterV3.Cluster{
+		Name: "backend",
+		EdsClusterConfig: &clusterV3.Cluster_EdsClusterConfig{
+			EdsConfig: &coreV3.ConfigSource{
+				ConfigSourceSpecifier: &coreV3.ConfigSource_ApiConfigSource{
+					ApiConfigSource: &coreV3.ApiConfigSource{
+						ApiType:      coreV3.ApiConfigSource_GRPC,
+						ClusterNames: []string{"other-control-plane"},
+					},
+				},
+			},
+		},
+	}))
+
+	assert.Empty(t, ReferencesOf(listenerWithRds(t, "ingress", &hcmV3.Rds{
+		RouteConfigName: "routes",
+		ConfigSource: &coreV3.ConfigSource{
+			ConfigSourceSpecifier: &coreV3.ConfigSource_Path{Path: "/etc/envoy/routes.yaml"},
+		},
+	})))
+
+	assert.Empty(t, ReferencesOf(listenerWithRds(t, "ingress", &hcmV3.Rds{RouteConfigName: "routes"})))
+
+	assert.Empty(t, ReferencesOf(&endpointV3.ClusterLoadAssignment{ClusterName: "backend"}))
+}
+
+func TestServerResolvesReferences(t *testing.T) {
+	srv := NewServer()
+
+	var lock sync.Mutex
+	notified := map[ResourceName]int{}
+
+	srv.Notify(func(name ResourceName) {
+		lock.Lock()
+		defer lock.Unlock()
+		notified[name]++
+	})
+
+	require.NoError(t, srv.UpdateResource("default/listener/ingress",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		listenerWithRoutes(t, "ingress", "routes")))
+
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "routes"}},
+		srv.UnresolvedReferences("default/listener/ingress"))
+
+	// Publishing the route configuration resolves the reference,
+	// and notifies the listener.
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/routes",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&routeV3.RouteConfiguration{Name: "routes"}))
+
+	assert.Empty(t, srv.UnresolvedReferences("default/listener/ingress"))
+	assert.Contains(t, notified, ResourceName("default/listener/ingress"))
+
+	delete(notified, "default/listener/ingress")
+
+	// Deleting it breaks the reference again.
+	srv.DeleteResource("default/routeconfiguration/routes")
+
+	assert.Len(t, srv.UnresolvedReferences("default/listener/ingress"), 1)
+	assert.Contains(t, notified, ResourceName("default/listener/ingress"))
+
+	// References only resolve on the same Envoy nodes.
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/routes",
+		ResourceVersion{Identifier: "2", Version: "2"}, NodeSelector{"other"},
+		&routeV3.RouteConfiguration{Name: "routes"}))
+	require.NoError(t, srv.UpdateResource("default/listener/ingress",
+		ResourceVersion{Identifier: "1", Version: "2"}, NodeSelector{"edge"},
+		listenerWithRoutes(t, "ingress", "routes")))
+
+	assert.Len(t, srv.UnresolvedReferences("default/listener/ingress"), 1)
+}
@@ -0,0 +1,172 @@
+package xds
+
+import (
+	"google.golang.org/protobuf/proto"
+)
+
+// referenceTable is the part of a resource table that references are
+// resolved against. The Server resolves references against its own
+// resource table, and ResolveReferences against a table that it builds.
+type referenceTable struct {
+	Resources map[ResourceName]*resourceEntry
+	Names     map[resourceKey]map[ResourceName]struct{}
+	Held      map[ResourceName]struct{}
+}
+
+// conflictOf returns the name of the resource in the table that
+// prevents entry from being published as name.
+func (t referenceTable) conflictOf(name ResourceName, entry *resourceEntry) (ResourceName, bool) {
+	key := keyOf(entry)
+	if key.Name == "" {
+		return "", false
+	}
+
+	for owner := range t.Names[key] {
+		if owner != name && t.Resources[owner].Nodes.Overlaps(entry.Nodes) {
+			return owner, true
+		}
+	}
+
+	return "", false
+}
+
+// unresolved returns the references from entry that don't resolve.
+func (t referenceTable) unresolved(entry *resourceEntry) []Reference {
+	var missing []Reference
+
+	for _, ref := range entry.Refs {
+		if !t.resolves(ref, entry.Nodes) {
+			missing = append(missing, ref)
+		}
+	}
+
+	return missing
+}
+
+// resolves returns true if the reference names published resources
+// that, between them, are published to every node group that nodes
+// selects, so that no node group is sent a dangling reference. Only a
+// resource that is published to every node can resolve a reference
+// from a resource that is published to every node. Resources that are
+// held back aren't published, so they don't resolve references.
+func (t referenceTable) resolves(ref Reference, nodes NodeSelector) bool {
+	covered := map[string]struct{}{}
+
+	for owner := range t.Names[resourceKey(ref)] {
+		if _, held := t.Held[owner]; held {
+			continue
+		}
+
+		selector := t.Resources[owner].Nodes
+		if len(selector) == 0 {
+			return true
+		}
+
+		for _, g := range selector {
+			covered[g] = struct{}{}
+		}
+	}
+
+	if len(nodes) == 0 {
+		return false
+	}
+
+	for _, g := range nodes {
+		if _, ok := covered[g]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// holdUnresolved adds the resources that hold says must be held back,
+// given their unresolved references, to the held set. Since a held
+// resource can't resolve a reference, holding a resource can cause the
+// resources that refer to it to be held too, so we repeat until nothing
+// changes.
+func (t referenceTable) holdUnresolved(hold func(*resourceEntry, []Reference) bool) {
+	for changed := true; changed; {
+		changed = false
+
+		for name, r := range t.Resources {
+			if _, held := t.Held[name]; held {
+				continue
+			}
+
+			if hold(r, t.unresolved(r)) {
+				t.Held[name] = struct{}{}
+				changed = true
+			}
+		}
+	}
+}
+
+// Resource is an Envoy resource whose references are resolved by
+// ResolveReferences.
+type Resource struct {
+	Name    ResourceName
+	Nodes   NodeSelector
+	Message proto.Message
+}
+
+// ResolveReferences resolves the references between the given
+// resources in the same way as a Server that holds back every kind of
+// resource (see HoldUnresolved), without having to serve them. It
+// returns the unresolved references of each resource that has any.
+// A resource whose Envoy name conflicts with an earlier resource is
+// left out, as the Server would hold it pending, and a conflict error
+// is returned for it instead. If qualify is true, references are
+// qualified first (see QualifyReferences).
+func ResolveReferences(
+	resources []Resource, qualify bool,
+) (map[ResourceName][]Reference, map[ResourceName]*NameConflictError) {
+	table := referenceTable{
+		Resources: map[ResourceName]*resourceEntry{},
+		Names:     map[resourceKey]map[ResourceName]struct{}{},
+		Held:      map[ResourceName]struct{}{},
+	}
+
+	conflicts := map[ResourceName]*NameConflictError{}
+
+	for _, r := range resources {
+		message := r.Message
+		if qualify {
+			message = QualifyNames(message, namespaceOf(r.Name))
+		}
+
+		entry := &resourceEntry{
+			Nodes:   r.Nodes,
+			Message: message,
+			Refs:    ReferencesOf(message),
+		}
+
+		key := keyOf(entry)
+
+		if owner, ok := table.conflictOf(r.Name, entry); ok {
+			conflicts[r.Name] = &NameConflictError{Kind: key.Kind, Name: key.Name, Owner: owner}
+			continue
+		}
+
+		if table.Names[key] == nil {
+			table.Names[key] = map[ResourceName]struct{}{}
+		}
+
+		table.Resources[r.Name] = entry
+		table.Names[key][r.Name] = struct{}{}
+	}
+
+	table.holdUnresolved(func(_ *resourceEntry, unresolved []Reference) bool {
+		return len(unresolved) > 0
+	})
+
+	unresolved := map[ResourceName][]Reference{}
+
+	for name, entry := range table.Resources {
+		if refs := table.unresolved(entry); len(refs) > 0 {
+			unresolved[name] = refs
+		}
+	}
+
+	return unresolved, conflicts
+}
@@ -0,0 +1,45 @@
+package xds
+
+import (
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveReferences(t *testing.T) {
+	unresolved, conflicts := ResolveReferences([]Resource{
+		{Name: "default/listener/ingress", Message: listenerWithRoutes(t, "ingress", "routes")},
+		{Name: "default/routeconfiguration/routes", Message: &routeV3.RouteConfiguration{Name: "routes"}},
+		{Name: "default/listener/edge", Nodes: NodeSelector{"edge"}, Message: listenerWithRoutes(t, "edge", "mesh")},
+		{
+			Name:    "default/routeconfiguration/mesh",
+			Nodes:   NodeSelector{"mesh"},
+			Message: &routeV3.RouteConfiguration{Name: "mesh"},
+		},
+		{Name: "default/cluster/other", Nodes: NodeSelector{"edge"}, Message: &clusterV3.Cluster{Name: "other"}},
+		{Name: "default/cluster/duplicate", Message: &clusterV3.Cluster{Name: "other"}},
+	}, false)
+
+	// The "mesh" routes aren't published to the "edge" listener.
+	assert.Equal(t, map[ResourceName][]Reference{
+		"default/listener/edge": {{Kind: "RouteConfiguration", Name: "mesh"}},
+	}, unresolved)
+
+	// The duplicate cluster is published to every node, so it
+	// conflicts with the cluster that is published to "edge".
+
+	assert.Equal(t, map[ResourceName]*NameConflictError{
+		"default/cluster/duplicate": {Kind: "Cluster", Name: "other", Owner: "default/cluster/other"},
+	}, conflicts)
+
+	// Qualified references resolve to the qualified names.
+	unresolved, conflicts = ResolveReferences([]Resource{
+		{Name: "team/listener/ingress", Message: listenerWithRoutes(t, "team/ingress", "routes")},
+		{Name: "team/routeconfiguration/routes", Message: &routeV3.RouteConfiguration{Name: "team/routes"}},
+	}, true)
+
+	assert.Empty(t, unresolved)
+	assert.Empty(t, conflicts)
+}
@@ -0,0 +1,222 @@
+package xds
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discoveryV3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	routeserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	scopedRouteTypeV3 = "type.googleapis.com/envoy.config.route.v3.ScopedRouteConfiguration"
+	virtualHostTypeV3 = "type.googleapis.com/envoy.config.route.v3.VirtualHost"
+)
+
+// scopedRoutesServerV3 serves scoped route discovery, which the
+// go-control-plane server doesn't register.
+type scopedRoutesServerV3 struct {
+	srv *Server
+}
+
+var _ routeserviceV3.ScopedRoutesDiscoveryServiceServer = scopedRoutesServerV3{}
+
+func (s scopedRoutesServerV3) StreamScopedRoutes(
+	stream routeserviceV3.ScopedRoutesDiscoveryService_StreamScopedRoutesServer) error {
+	return s.srv.v3.StreamHandler(stream, scopedRouteTypeV3)
+}
+
+func (s scopedRoutesServerV3) DeltaScopedRoutes(
+	stream routeserviceV3.ScopedRoutesDiscoveryService_DeltaScopedRoutesServer) error {
+	return s.srv.streamDelta(stream, scopedRouteTypeV3)
+}
+
+func (s scopedRoutesServerV3) FetchScopedRoutes(
+	context.Context, *discoveryV3.DiscoveryRequest) (*discoveryV3.DiscoveryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "scoped route fetch is not supported")
+}
+
+// virtualHostServerV3 serves on-demand virtual host discovery, which
+// is only defined for the delta xDS protocol.
+type virtualHostServerV3 struct {
+	srv *Server
+}
+
+var _ routeserviceV3.VirtualHostDiscoveryServiceServer = virtualHostServerV3{}
+
+func (v virtualHostServerV3) DeltaVirtualHosts(
+	stream routeserviceV3.VirtualHostDiscoveryService_DeltaVirtualHostsServer) error {
+	return v.srv.streamDelta(stream, virtualHostTypeV3)
+}
+
+// resolveVirtualHosts resolves a VHDS subscription. Envoy first
+// subscribes to the name of the route configuration, which selects
+// every virtual host named "<route configuration>/<virtual host>".
+// Subsequent on-demand subscriptions are for aliases of the form
+// "<route configuration>/<host>", which select the virtual host in
+// that route configuration whose domains match the host. Route
+// configuration names may themselves contain "/" (for example, when
+// they are qualified with a namespace), so a subscription is matched
+// to the longest known route configuration name first. The caller
+// must hold the resource table lock.
+func (srv *Server) resolveVirtualHosts(group string, names map[string]struct{}) map[string]deltaResource {
+	hosts := map[string]*routeV3.VirtualHost{}
+	versions := map[string]string{}
+	routeConfigs := map[string]struct{}{}
+
+	for name, r := range srv.resources {
+		if !r.Nodes.Matches(group) {
+			continue
+		}
+
+		if rc, ok := r.messageFor(resourceV3.RouteType).(*routeV3.RouteConfiguration); ok {
+			routeConfigs[rc.GetName()] = struct{}{}
+		}
+
+		if srv.isHeld(name) {
+			continue
+		}
+
+		if vhost, ok := r.messageFor(virtualHostTypeV3).(*routeV3.VirtualHost); ok {
+			hosts[vhost.GetName()] = vhost
+			versions[vhost.GetName()] = strconv.FormatUint(r.Changed, 10)
+		}
+	}
+
+	// Group the virtual hosts by their route configuration.
+	configHosts := map[string]map[string]*routeV3.VirtualHost{}
+
+	for name, vhost := range hosts {
+		rc, _ := splitVirtualHostAlias(routeConfigs, name)
+		if configHosts[rc] == nil {
+			configHosts[rc] = map[string]*routeV3.VirtualHost{}
+		}
+
+		configHosts[rc][name] = vhost
+	}
+
+	resolved := map[string]deltaResource{}
+
+	add := func(name string, alias string) {
+		d, ok := resolved[name]
+		if !ok {
+			d = deltaResource{
+				Version: versions[name],
+				Message: hosts[name],
+			}
+		}
+
+		if alias != "" {
+			d.Aliases = append(d.Aliases, alias)
+		}
+
+		resolved[name] = d
+	}
+
+	for subscribed := range names {
+		routeConfig, host := splitVirtualHostAlias(routeConfigs, subscribed)
+
+		// Subscription to a whole route configuration.
+		if host == "" {
+			for name := range configHosts[routeConfig] {
+				add(name, "")
+			}
+
+			continue
+		}
+
+		// Subscription to an explicitly named virtual host.
+		if _, ok := hosts[subscribed]; ok {
+			add(subscribed, "")
+			continue
+		}
+
+		// On-demand subscription to a host alias.
+		if name, ok := matchVirtualHost(configHosts[routeConfig], host); ok {
+			add(name, subscribed)
+			continue
+		}
+
+		// Tell Envoy that the alias doesn't resolve, so that it
+		// can stop waiting for it.
+		resolved[subscribed] = deltaResource{Aliases: []string{subscribed}}
+	}
+
+	return resolved
+}
+
+// splitVirtualHostAlias splits a VHDS subscription into the route
+// configuration and the host. The route configuration is the longest
+// known route configuration name that prefixes the subscription, or
+// else everything up to the first "/". The host is empty if the
+// subscription is for the whole route configuration.
+func splitVirtualHostAlias(routeConfigs map[string]struct{}, subscribed string) (string, string) {
+	if _, ok := routeConfigs[subscribed]; ok {
+		return subscribed, ""
+	}
+
+	best := ""
+
+	for rc := range routeConfigs {
+		if len(rc) > len(best) && strings.HasPrefix(subscribed, rc+"/") {
+			best = rc
+		}
+	}
+
+	if best != "" {
+		return best, strings.TrimPrefix(subscribed, best+"/")
+	}
+
+	parts := strings.SplitN(subscribed, "/", 2)
+	if len(parts) == 1 {
+		return subscribed, ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// matchVirtualHost returns the name of the virtual host whose domains
+// best match host, following the Envoy precedence of exact, suffix
+// wildcard, prefix wildcard and then the default "*" domain.
+func matchVirtualHost(hosts map[string]*routeV3.VirtualHost, host string) (string, bool) {
+	const (
+		matchNone = iota
+		matchDefault
+		matchPrefix
+		matchSuffix
+		matchExact
+	)
+
+	best := ""
+	bestMatch := matchNone
+	bestLen := 0
+
+	for name, vhost := range hosts {
+		for _, domain := range vhost.GetDomains() {
+			match := matchNone
+
+			switch {
+			case domain == host:
+				match = matchExact
+			case domain == "*":
+				match = matchDefault
+			case strings.HasPrefix(domain, "*") && strings.HasSuffix(host, domain[1:]):
+				match = matchSuffix
+			case strings.HasSuffix(domain, "*") && strings.HasPrefix(host, domain[:len(domain)-1]):
+				match = matchPrefix
+			}
+
+			// Longer wildcard domains are more specific.
+			if match > bestMatch || (match == bestMatch && match != matchNone && len(domain) > bestLen) {
+				best, bestMatch, bestLen = name, match, len(domain)
+			}
+		}
+	}
+
+	return best, bestMatch != matchNone
+}
@@ -0,0 +1,132 @@
+package xds
+
+import (
+	"testing"
+
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	cacheV3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPublishesScopedRoutes(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/routes",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&routeV3.RouteConfiguration{Name: "routes"}))
+	require.NoError(t, srv.UpdateResource("default/scopedrouteconfiguration/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&routeV3.ScopedRouteConfiguration{Name: "one", RouteConfigurationName: "routes"}))
+
+	watch, cancel := srv.scopedRoutesV3.CreateWatch(&cacheV3.Request{
+		Node:    &coreV3.Node{},
+		TypeUrl: scopedRouteTypeV3,
+	})
+	assert.Nil(t, cancel)
+
+	resp := <-watch
+	discovery, err := resp.GetDiscoveryResponse()
+	require.NoError(t, err)
+
+	assert.Equal(t, "2", discovery.GetVersionInfo())
+	assert.Len(t, discovery.GetResources(), 1)
+}
+
+func TestServerResolvesVirtualHosts(t *testing.T) {
+	srv := NewServer()
+
+	hosts := map[string][]string{
+		"routes/exact":    {"www.example.com"},
+		"routes/wildcard": {"*.example.com"},
+		"routes/default":  {"*"},
+		"other/exact":     {"www.example.com"},
+	}
+
+	for name, domains := range hosts {
+		require.NoError(t, srv.UpdateResource(ResourceName("default/virtualhost/"+name),
+			ResourceVersion{Identifier: name, Version: "1"}, nil,
+			&routeV3.VirtualHost{Name: name, Domains: domains}))
+	}
+
+	resolve := func(names ...string) map[string]deltaResource {
+		subscription := map[string]struct{}{}
+		for _, n := range names {
+			subscription[n] = struct{}{}
+		}
+
+		srv.lock.Lock()
+		defer srv.lock.Unlock()
+
+		return srv.resolveVirtualHosts("", subscription)
+	}
+
+	// Subscribing to the route configuration selects its virtual hosts.
+	resolved := resolve("routes")
+	assert.Len(t, resolved, 3)
+	assert.NotContains(t, resolved, "other/exact")
+
+	// Aliases resolve to the best matching virtual host.
+	resolved = resolve("routes/www.example.com", "routes/api.example.com", "routes/example.org")
+	assert.Equal(t, []string{"routes/www.example.com"}, resolved["routes/exact"].Aliases)
+	assert.Equal(t, []string{"routes/api.example.com"}, resolved["routes/wildcard"].Aliases)
+	assert.Equal(t, []string{"routes/example.org"}, resolved["routes/default"].Aliases)
+
+	// Unresolved aliases are sent without a resource.
+	resolved = resolve("missing/www.example.com")
+	require.Contains(t, resolved, "missing/www.example.com")
+	assert.Nil(t, resolved["missing/www.example.com"].Message)
+}
+
+func TestServerResolvesQualifiedVirtualHosts(t *testing.T) {
+	srv := NewServer()
+
+	for _, rc := range []string{"default/routes", "default"} {
+		require.NoError(t, srv.UpdateResource(ResourceName("default/routeconfiguration/"+rc),
+			ResourceVersion{Identifier: rc, Version: "1"}, nil,
+			&routeV3.RouteConfiguration{Name: rc}))
+	}
+
+	hosts := map[string][]string{
+		"default/routes/exact":   {"www.example.com"},
+		"default/routes/default": {"*"},
+		"default/other":          {"www.example.com"},
+	}
+
+	for name, domains := range hosts {
+		require.NoError(t, srv.UpdateResource(ResourceName("default/virtualhost/"+name),
+			ResourceVersion{Identifier: name, Version: "1"}, nil,
+			&routeV3.VirtualHost{Name: name, Domains: domains}))
+	}
+
+	resolve := func(names ...string) map[string]deltaResource {
+		subscription := map[string]struct{}{}
+		for _, n := range names {
+			subscription[n] = struct{}{}
+		}
+
+		srv.lock.Lock()
+		defer srv.lock.Unlock()
+
+		return srv.resolveVirtualHosts("", subscription)
+	}
+
+	// The longest route configuration name is matched first.
+	resolved := resolve("default/routes")
+	assert.Len(t, resolved, 2)
+	assert.Contains(t, resolved, "default/routes/exact")
+	assert.Contains(t, resolved, "default/routes/default")
+
+	resolved = resolve("default")
+	assert.Len(t, resolved, 1)
+	assert.Contains(t, resolved, "default/other")
+
+	resolved = resolve("default/routes/www.example.com", "default/routes/example.org")
+	assert.Equal(t, []string{"default/routes/www.example.com"}, resolved["default/routes/exact"].Aliases)
+	assert.Equal(t, []string{"default/routes/example.org"}, resolved["default/routes/default"].Aliases)
+
+	resolved = resolve("default/www.example.com")
+	assert.Equal(t, []string{"default/www.example.com"}, resolved["default/other"].Aliases)
+}
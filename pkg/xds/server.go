@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 
 	clusterserviceV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	endpointserviceV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	listenerserviceV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	routeserviceV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	coreV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	coreV3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	clusterserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discoveryserviceV2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	runtimeserviceV2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
@@ -19,28 +22,125 @@ import (
 	routeserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
 	runtimeserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
 	secretserviceV3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	cacheV2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
 	cacheV3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/log"
+	resourceV2 "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	restV3 "github.com/envoyproxy/go-control-plane/pkg/server/rest/v3"
+	sotwV3 "github.com/envoyproxy/go-control-plane/pkg/server/sotw/v3"
 	serverV2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
 	serverV3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/go-logr/logr"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/proto"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// nodeGroupHashV2 hashes Envoy nodes to their node group.
+type nodeGroupHashV2 struct{}
+
+// ID returns the service cluster of the node.
+func (nodeGroupHashV2) ID(node *coreV2.Node) string { return node.GetCluster() }
+
+// nodeGroupHashV3 hashes Envoy nodes to their node group.
+type nodeGroupHashV3 struct{}
+
+// ID returns the service cluster of the node.
+func (nodeGroupHashV3) ID(node *coreV3.Node) string { return node.GetCluster() }
+
+// resourceEntry is a resource that is held in the Server resource table.
+type resourceEntry struct {
+	Version ResourceVersion
+	Nodes   NodeSelector
+	Message proto.Message
+
+	// Upgraded is the v3 translation of a v2 Message, so that
+	// v3 clients see the same resources as v2 clients.
+	Upgraded proto.Message
+
+	// Refs lists the resources that Message refers to.
+	Refs []Reference
+
+	// Restored is true if the resource was restored from a
+	// persisted snapshot and has not been updated since.
+	Restored bool
+
+	// Changed is the snapshot version that first published
+	// this revision of the resource.
+	Changed uint64
+	// Acked is true if any Envoy has accepted this revision.
+	Acked bool
+	// Nacks holds the errors from the streams that rejected
+	// this revision.
+	Nacks map[streamKey]string
+}
+
 // Server is a handle to a GRPC server that implements the xDS v2 and v3 protocols.
 type Server struct {
 	v2   serverV2.Server
 	v3   serverV3.Server
 	grpc *grpc.Server
+	log  logr.Logger
+
+	cacheV2 cacheV2.SnapshotCache
+	cacheV3 cacheV3.SnapshotCache
+
+	// scopedRoutesV3 holds the v3 scoped route configurations,
+	// which the snapshot cache doesn't support.
+	scopedRoutesV3 *opaqueCache
+
+	// deltaStreamID numbers the delta streams, which are served
+	// outside of go-control-plane.
+	deltaStreamID int64
+
+	// batchLock serializes batches (see Batch).
+	batchLock sync.Mutex
+
+	lock      sync.Mutex
+	version   uint64
+	sequence  uint64
+	groups    map[string]struct{}
+	streams   map[streamKey]*streamState
+	resources map[ResourceName]*resourceEntry
+	pending   map[ResourceName]*pendingEntry
+	names     map[resourceKey]map[ResourceName]struct{}
+	referrers map[resourceKey]map[ResourceName]struct{}
+	gated     map[string]struct{}
+	held      map[ResourceName]struct{}
+	qualify   bool
+	notifiers []func(ResourceName)
+
+	// versionInfo is the string form of the current snapshot
+	// version, which may be a label (see Batch). The labels map
+	// the labels back to snapshot versions.
+	versionInfo string
+	labels      map[string]uint64
+	label       string
+	batching    bool
+
+	// persister writes published snapshots to the persist
+	// file (see Persist).
+	persister *snapshotWriter
+
+	// syncing is set until the resource source has synced
+	// (see HoldUntilSynced).
+	syncing *syncState
+
+	// deltaWatchers wakes the delta streams when new resources
+	// are published.
+	deltaWatchers map[streamKey]chan struct{}
 }
 
 var _ ResourceStore = &Server{}
 
 // NewServer returns a new xDS server for both the v2 and v3 Envoy
-// API. The internal cache always uses the identity node hash since
-// the deployment model is one envoy-controller for each Envoy server.
+// API. Envoy nodes are grouped by their service cluster, and each
+// node group is served a snapshot of the resources that select it.
+// The v3 API is also served over the incremental (delta) protocol.
+// Resources with unresolved references are held back from Envoy
+// (see HoldUnresolved).
 func NewServer(options ...grpc.ServerOption) *Server {
 	logger := ctrl.Log.WithName("xds")
 
@@ -62,19 +162,46 @@ func NewServer(options ...grpc.ServerOption) *Server {
 	}
 
 	srv := Server{
-		v2: serverV2.NewServer(
-			context.Background(),
-			cacheV2.NewSnapshotCache(true /* ads */, cacheV2.IDHash{}, l),
-			nil, /* callbacks */
-		),
+		cacheV2:        cacheV2.NewSnapshotCache(true /* ads */, nodeGroupHashV2{}, l),
+		cacheV3:        cacheV3.NewSnapshotCache(true /* ads */, nodeGroupHashV3{}, l),
+		scopedRoutesV3: newOpaqueCache(nodeGroupHashV3{}),
+		grpc:           grpc.NewServer(options...),
+		log:            logger,
+		groups:         map[string]struct{}{},
+		streams:        map[streamKey]*streamState{},
+		resources:      map[ResourceName]*resourceEntry{},
+		pending:        map[ResourceName]*pendingEntry{},
+		names:          map[resourceKey]map[ResourceName]struct{}{},
+		referrers:      map[resourceKey]map[ResourceName]struct{}{},
+		gated:          map[string]struct{}{},
+		held:           map[ResourceName]struct{}{},
+		deltaWatchers:  map[streamKey]chan struct{}{},
+		versionInfo:    "0",
+		labels:         map[string]uint64{},
+	}
 
-		v3: serverV3.NewServer(
-			context.Background(),
-			cacheV3.NewSnapshotCache(true /* ads */, cacheV3.IDHash{}, l),
-			nil, /* callbacks */
-		),
+	// Hold back every kind of resource until its references resolve.
+	for _, k := range Kinds() {
+		srv.gated[k] = struct{}{}
+	}
 
-		grpc: grpc.NewServer(options...),
+	// Route scoped routes to their own cache, since the snapshot
+	// cache doesn't know about them. This also makes them available
+	// on the aggregated stream.
+	mux := typeMuxCache{
+		"":                srv.cacheV3,
+		scopedRouteTypeV3: srv.scopedRoutesV3,
+	}
+
+	callbacksV3 := srv.callbacksV3()
+
+	srv.v2 = serverV2.NewServer(context.Background(), srv.cacheV2, srv.callbacksV2())
+	srv.v3 = deltaServerV3{
+		Server: serverV3.NewServerAdvanced(
+			restV3.NewServer(srv.cacheV3, callbacksV3),
+			sotwV3.NewServer(context.Background(), mux, callbacksV3),
+		),
+		srv: &srv,
 	}
 
 	clusterserviceV3.RegisterClusterDiscoveryServiceServer(srv.grpc, srv.v3)
@@ -85,9 +212,12 @@ func NewServer(options ...grpc.ServerOption) *Server {
 	runtimeserviceV3.RegisterRuntimeDiscoveryServiceServer(srv.grpc, srv.v3)
 	secretserviceV3.RegisterSecretDiscoveryServiceServer(srv.grpc, srv.v3)
 
-	// go-control-plane doesn't support scoped routes or virtualhosts:
+	// go-control-plane doesn't support scoped routes or virtualhosts,
+	// so we serve these ourselves (v3 only):
 	// 	https://github.com/envoyproxy/go-control-plane/issues/310
 	// 	https://github.com/envoyproxy/go-control-plane/issues/309
+	routeserviceV3.RegisterScopedRoutesDiscoveryServiceServer(srv.grpc, scopedRoutesServerV3{srv: &srv})
+	routeserviceV3.RegisterVirtualHostDiscoveryServiceServer(srv.grpc, virtualHostServerV3{srv: &srv})
 
 	clusterserviceV2.RegisterClusterDiscoveryServiceServer(srv.grpc, srv.v2)
 	discoveryserviceV2.RegisterAggregatedDiscoveryServiceServer(srv.grpc, srv.v2)
@@ -129,17 +259,246 @@ func (srv *Server) Start(listener net.Listener, stopChan <-chan struct{}) error
 	}
 }
 
-// UpdateResource ...
-func (srv *Server) UpdateResource(name ResourceName, vers ResourceVersion, message proto.Message) {
-	// TODO(jpeach) Enforce the invariant that names are globally unique.
-	switch VersionForMessage(message.ProtoReflect().Descriptor()) {
-	case EnvoyVersion2:
-	case EnvoyVersion3:
+// UpdateResource adds or replaces the named resource and publishes
+// new snapshots to the xDS caches. v2 resources are translated and
+// published to v3 clients too. Envoy resource names must be
+// unique for each kind of resource, so if another resource already
+// has the same Envoy name, the update is held pending and a
+// NameConflictError is returned. The pending update is published
+// automatically when the name becomes available.
+func (srv *Server) UpdateResource(
+	name ResourceName, vers ResourceVersion, nodes NodeSelector, message proto.Message) error {
+	var promoted []ResourceName
+	var upgraded proto.Message
+
+	srv.lock.Lock()
+	qualify := srv.qualify
+	srv.lock.Unlock()
+
+	if qualify {
+		message = QualifyNames(message, namespaceOf(name))
+	}
+
+	if VersionForMessage(message.ProtoReflect().Descriptor()) == EnvoyVersion2 {
+		var err error
+
+		if upgraded, err = TranslateV3(message); err != nil {
+			srv.RejectResource(name)
+			return fmt.Errorf("failed to translate v2 resource: %w", err)
+		}
+	}
+
+	defer func() { srv.notify(promoted) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	// This update supersedes any pending update.
+	delete(srv.pending, name)
+
+	// Status updates bump the Kubernetes resource version, so don't
+	// churn Envoy unless the resource itself actually changed.
+	if current, ok := srv.resources[name]; ok &&
+		equalSelectors(current.Nodes, nodes) && proto.Equal(current.Message, message) {
+		current.Version = vers
+		current.Restored = false
+		promoted = srv.syncResource(name)
+		return nil
+	}
+
+	entry := &resourceEntry{
+		Version:  vers,
+		Nodes:    nodes,
+		Message:  message,
+		Upgraded: upgraded,
+		Refs:     ReferencesOf(message),
+	}
+
+	if owner, ok := srv.conflictOf(name, entry); ok {
+		srv.sequence++
+		srv.pending[name] = &pendingEntry{Entry: entry, Sequence: srv.sequence}
+
+		key := keyOf(entry)
+		promoted = srv.syncResource(name)
+
+		return &NameConflictError{Kind: key.Kind, Name: key.Name, Owner: owner}
 	}
+
+	promoted = srv.store(name, entry)
+	promoted = append(promoted, srv.publish()...)
+	promoted = append(promoted, srv.syncResource(name)...)
+
+	return nil
 }
 
-// DeleteResource ...
+// DeleteResource removes the named resource and publishes new
+// snapshots to the xDS caches.
 func (srv *Server) DeleteResource(name ResourceName) {
+	var promoted []ResourceName
+
+	defer func() { srv.notify(promoted) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.pending, name)
+
 	// name is globally unique, so we can safely delete the
 	// corresponding entry from both the v2 and v3 resources.
+	if _, ok := srv.resources[name]; !ok {
+		promoted = srv.syncResource(name)
+		return
+	}
+
+	promoted = srv.remove(name)
+	promoted = append(promoted, srv.publish()...)
+	promoted = append(promoted, srv.syncResource(name)...)
+}
+
+// observeNodeGroup ensures that a snapshot is published for the given
+// node group. Node groups are discovered as Envoy nodes connect.
+func (srv *Server) observeNodeGroup(group string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if _, ok := srv.groups[group]; ok {
+		return
+	}
+
+	srv.groups[group] = struct{}{}
+
+	// Until the first resource is published, or while a batch or
+	// a sync is holding back changes, the new group will be picked
+	// up by the next publish along with all the others.
+	if srv.version > 0 && !srv.batching && srv.syncing == nil {
+		srv.publishGroup(group, srv.versionInfo)
+	}
+}
+
+// publish generates new snapshots from the resource table for each
+// known node group. It returns the names of the resources that were
+// held back or released by this update. While a batch is in progress,
+// publishing is deferred until the batch ends, and until the resource
+// source has synced, publishing is deferred until it has. The caller
+// must hold the resource table lock.
+func (srv *Server) publish() []ResourceName {
+	if srv.batching || srv.syncing != nil {
+		return nil
+	}
+
+	held := srv.holdUnresolved()
+	version := srv.nextVersion()
+
+	for group := range srv.groups {
+		srv.publishGroup(group, version)
+	}
+
+	srv.wakeDeltaStreams()
+	srv.persist()
+
+	srv.log.V(1).Info("published snapshots",
+		"version", version, "groups", len(srv.groups),
+		"resources", len(srv.resources), "held", len(srv.held))
+
+	return held
+}
+
+// publishGroup generates new v2 and v3 snapshots for the given node
+// group and stores them in the corresponding caches. The caller must
+// hold the resource table lock.
+func (srv *Server) publishGroup(group string, version string) {
+	resources := map[string][]types.Resource{}
+
+	for name, r := range srv.resources {
+		if !r.Nodes.Matches(group) || srv.isHeld(name) {
+			continue
+		}
+
+		for _, m := range r.messages() {
+			typeURL := TypeURL(m)
+
+			switch typeURL {
+			case scopedRouteTypeV3:
+				resources[typeURL] = append(resources[typeURL], ProtoV1(m))
+				continue
+			case virtualHostTypeV3:
+				// Virtual hosts are served on delta streams.
+				continue
+			}
+
+			// The v2 and v3 caches only support the core xDS types.
+			if cacheV2.GetResponseType(typeURL) == types.UnknownType &&
+				cacheV3.GetResponseType(typeURL) == types.UnknownType {
+				srv.log.Info("skipping unsupported resource type",
+					"resource", name, "type", typeURL)
+				continue
+			}
+
+			resources[typeURL] = append(resources[typeURL], ProtoV1(m))
+		}
+	}
+
+	snapV2 := cacheV2.NewSnapshot(version,
+		resources[resourceV2.EndpointType],
+		resources[resourceV2.ClusterType],
+		resources[resourceV2.RouteType],
+		resources[resourceV2.ListenerType],
+		resources[resourceV2.RuntimeType],
+		resources[resourceV2.SecretType],
+	)
+
+	snapV3 := cacheV3.NewSnapshot(version,
+		resources[resourceV3.EndpointType],
+		resources[resourceV3.ClusterType],
+		resources[resourceV3.RouteType],
+		resources[resourceV3.ListenerType],
+		resources[resourceV3.RuntimeType],
+		resources[resourceV3.SecretType],
+	)
+
+	if err := srv.cacheV2.SetSnapshot(group, snapV2); err != nil {
+		srv.log.Error(err, "failed to set v2 snapshot", "group", group, "version", version)
+	}
+
+	if err := srv.cacheV3.SetSnapshot(group, snapV3); err != nil {
+		srv.log.Error(err, "failed to set v3 snapshot", "group", group, "version", version)
+	}
+
+	srv.scopedRoutesV3.SetResources(group, version, resources[scopedRouteTypeV3])
+}
+
+// messages returns each form of the resource message.
+func (r *resourceEntry) messages() []proto.Message {
+	if r.Upgraded != nil {
+		return []proto.Message{r.Message, r.Upgraded}
+	}
+
+	return []proto.Message{r.Message}
+}
+
+// messageFor returns the form of the resource message that has
+// the given type URL, or nil if there isn't one.
+func (r *resourceEntry) messageFor(typeURL string) proto.Message {
+	for _, m := range r.messages() {
+		if TypeURL(m) == typeURL {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// equalSelectors returns true if the two selectors select the same node groups.
+func equalSelectors(a NodeSelector, b NodeSelector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
 }
@@ -0,0 +1,272 @@
+package xds
+
+import (
+	"errors"
+	"testing"
+
+	clusterV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routeV3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	resourceV2 "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPublishesSnapshots(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"})
+	srv.UpdateResource("default/cluster/two",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&clusterV2.Cluster{Name: "two"})
+	srv.UpdateResource("default/listener/three",
+		ResourceVersion{Identifier: "3", Version: "1"}, nil,
+		&listenerV3.Listener{Name: "three"})
+
+	snapV3, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Contains(t, snapV3.GetResources(resourceV3.ClusterType), "one")
+	assert.Contains(t, snapV3.GetResources(resourceV3.ClusterType), "two") // Translated from v2.
+	assert.Contains(t, snapV3.GetResources(resourceV3.ListenerType), "three")
+
+	snapV2, err := srv.cacheV2.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Contains(t, snapV2.GetResources(resourceV2.ClusterType), "two")
+	assert.Empty(t, snapV2.GetResources(resourceV2.ListenerType))
+
+	// Deleting a resource publishes a new version without it.
+	version := snapV3.GetVersion(resourceV3.ClusterType)
+	srv.DeleteResource("default/cluster/one")
+
+	snapV3, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, version, snapV3.GetVersion(resourceV3.ClusterType))
+	assert.NotContains(t, snapV3.GetResources(resourceV3.ClusterType), "one")
+}
+
+func TestServerSkipsUnchangedResources(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"})
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	version := snap.GetVersion(resourceV3.ClusterType)
+
+	// A new Kubernetes version with the same protobuf is not republished.
+	srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "2"}, nil,
+		&clusterV3.Cluster{Name: "one"})
+
+	snap, err = srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	assert.Equal(t, version, snap.GetVersion(resourceV3.ClusterType))
+}
+
+func TestServerPublishesNodeGroups(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("edge")
+
+	srv.UpdateResource("default/cluster/all",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "all"})
+	srv.UpdateResource("default/cluster/edge",
+		ResourceVersion{Identifier: "2", Version: "1"}, NodeSelector{"edge"},
+		&clusterV3.Cluster{Name: "edge"})
+	srv.UpdateResource("default/cluster/mesh",
+		ResourceVersion{Identifier: "3", Version: "1"}, NodeSelector{"mesh"},
+		&clusterV3.Cluster{Name: "mesh"})
+
+	snap, err := srv.cacheV3.GetSnapshot("edge")
+	require.NoError(t, err)
+
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "all")
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "edge")
+	assert.NotContains(t, snap.GetResources(resourceV3.ClusterType), "mesh")
+
+	// A node group that connects late gets the current resources immediately.
+	srv.observeNodeGroup("mesh")
+
+	snap, err = srv.cacheV3.GetSnapshot("mesh")
+	require.NoError(t, err)
+
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "all")
+	assert.NotContains(t, snap.GetResources(resourceV3.ClusterType), "edge")
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "mesh")
+}
+
+func TestServerResolvesReferencesForEveryNodeGroup(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("edge")
+	srv.observeNodeGroup("mesh")
+
+	require.NoError(t, srv.UpdateResource("default/listener/ingress",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		listenerWithRoutes(t, "ingress", "routes")))
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/edge",
+		ResourceVersion{Identifier: "2", Version: "1"}, NodeSelector{"edge"},
+		&routeV3.RouteConfiguration{Name: "routes"}))
+
+	// The listener is published to every node, but its routes are
+	// only published to "edge", so it is held back everywhere.
+	assert.True(t, srv.ResourceStatus("default/listener/ingress").Held)
+	assert.Equal(t,
+		[]Reference{{Kind: "RouteConfiguration", Name: "routes"}},
+		srv.UnresolvedReferences("default/listener/ingress"))
+
+	for _, group := range []string{"edge", "mesh"} {
+		snap, err := srv.cacheV3.GetSnapshot(group)
+		require.NoError(t, err)
+		assert.Empty(t, snap.GetResources(resourceV3.ListenerType), group)
+	}
+
+	// Routes for "mesh" still don't cover the node groups that
+	// haven't connected yet.
+	require.NoError(t, srv.UpdateResource("default/routeconfiguration/mesh",
+		ResourceVersion{Identifier: "3", Version: "1"}, NodeSelector{"mesh"},
+		&routeV3.RouteConfiguration{Name: "routes"}))
+
+	assert.True(t, srv.ResourceStatus("default/listener/ingress").Held)
+
+	// Between them, the routes cover a listener that is only
+	// published to "edge" and "mesh".
+	require.NoError(t, srv.UpdateResource("default/listener/ingress",
+		ResourceVersion{Identifier: "1", Version: "2"}, NodeSelector{"edge", "mesh"},
+		listenerWithRoutes(t, "ingress", "routes")))
+
+	assert.False(t, srv.ResourceStatus("default/listener/ingress").Held)
+
+	for _, group := range []string{"edge", "mesh"} {
+		snap, err := srv.cacheV3.GetSnapshot(group)
+		require.NoError(t, err)
+		assert.Contains(t, snap.GetResources(resourceV3.ListenerType), "ingress", group)
+	}
+}
+
+func TestServerTracksEnvoyStatus(t *testing.T) {
+	var notified []ResourceName
+
+	srv := NewServer()
+	srv.Notify(func(name ResourceName) { notified = append(notified, name) })
+	srv.observeNodeGroup("")
+
+	stream := streamKey{Version: EnvoyVersion3, ID: 1}
+
+	srv.UpdateResource("default/listener/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&listenerV3.Listener{Name: "one"})
+	srv.UpdateResource("default/listener/two",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&listenerV3.Listener{Name: "two"})
+
+	assert.Equal(t, ResourceStatus{}, srv.ResourceStatus("default/listener/one"))
+
+	srv.streamResponse(stream, "", resourceV3.ListenerType, "1", "2")
+	srv.streamRequest(stream, "", resourceV3.ListenerType, "1", "")
+
+	assert.Equal(t, ResourceStatus{Acked: true}, srv.ResourceStatus("default/listener/one"))
+	assert.Equal(t, ResourceStatus{Acked: true}, srv.ResourceStatus("default/listener/two"))
+	assert.ElementsMatch(t, []ResourceName{"default/listener/one", "default/listener/two"}, notified)
+
+	// Envoy names the listener that it rejected.
+	notified = nil
+	srv.UpdateResource("default/listener/two",
+		ResourceVersion{Identifier: "2", Version: "2"}, nil,
+		&listenerV3.Listener{Name: "two", Freebind: &wrappers.BoolValue{Value: true}})
+
+	srv.streamResponse(stream, "", resourceV3.ListenerType, "2", "3")
+	srv.streamRequest(stream, "", resourceV3.ListenerType, "2", "error adding listener 'two': bind failed")
+
+	assert.Equal(t, ResourceStatus{Acked: true}, srv.ResourceStatus("default/listener/one"))
+	assert.Equal(t, ResourceStatus{Errors: []string{"error adding listener 'two': bind failed"}},
+		srv.ResourceStatus("default/listener/two"))
+	assert.Equal(t, []ResourceName{"default/listener/two"}, notified)
+
+	// Closing the stream discards its NACKs.
+	srv.streamClosed(stream)
+	assert.Equal(t, ResourceStatus{}, srv.ResourceStatus("default/listener/two"))
+}
+
+func TestServerMatchesNackedNamesExactly(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+
+	stream := streamKey{Version: EnvoyVersion3, ID: 1}
+
+	for _, name := range []string{"foo", "foo-tls", "a"} {
+		require.NoError(t, srv.UpdateResource(ResourceName("default/listener/"+name),
+			ResourceVersion{Identifier: name, Version: "1"}, nil,
+			&listenerV3.Listener{Name: name}))
+	}
+
+	srv.streamResponse(stream, "", resourceV3.ListenerType, "1", "3")
+	srv.streamRequest(stream, "", resourceV3.ListenerType, "1",
+		"error adding listener foo-tls: invalid transport socket")
+
+	assert.NotEmpty(t, srv.ResourceStatus("default/listener/foo-tls").Errors)
+	assert.Empty(t, srv.ResourceStatus("default/listener/foo").Errors)
+	assert.Empty(t, srv.ResourceStatus("default/listener/a").Errors)
+
+	assert.True(t, mentionsName("listener 'foo' failed", "foo"))
+	assert.True(t, mentionsName("listener foo: failed", "foo"))
+	assert.True(t, mentionsName("failed to add foo.", "foo"))
+	assert.False(t, mentionsName("listener foo-tls: failed", "foo"))
+	assert.False(t, mentionsName("listener foo.bar: failed", "foo"))
+	assert.False(t, mentionsName("a bad listener", "bad-listener"))
+	assert.False(t, mentionsName("invalid value", "a"))
+}
+
+func TestServerEnforcesUniqueNames(t *testing.T) {
+	var notified []ResourceName
+
+	srv := NewServer()
+	srv.Notify(func(name ResourceName) { notified = append(notified, name) })
+	srv.observeNodeGroup("")
+
+	require.NoError(t, srv.UpdateResource("one/cluster/backend",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "backend"}))
+
+	// The same name in a different namespace conflicts.
+	err := srv.UpdateResource("two/cluster/backend",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "backend", AltStatName: "two"})
+
+	var conflict *NameConflictError
+
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, ResourceName("one/cluster/backend"), conflict.Owner)
+
+	// The same name for disjoint node groups does not conflict.
+	require.NoError(t, srv.UpdateResource("three/cluster/frontend",
+		ResourceVersion{Identifier: "3", Version: "1"}, NodeSelector{"edge"},
+		&clusterV3.Cluster{Name: "frontend"}))
+	require.NoError(t, srv.UpdateResource("four/cluster/frontend",
+		ResourceVersion{Identifier: "4", Version: "1"}, NodeSelector{"mesh"},
+		&clusterV3.Cluster{Name: "frontend"}))
+
+	// Deleting the owner promotes the pending resource.
+	srv.DeleteResource("one/cluster/backend")
+	assert.Equal(t, []ResourceName{"two/cluster/backend"}, notified)
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+
+	clusters := snap.GetResources(resourceV3.ClusterType)
+	require.Contains(t, clusters, "backend")
+	assert.Equal(t, "two", clusters["backend"].(*clusterV3.Cluster).AltStatName)
+}
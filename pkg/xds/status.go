@@ -0,0 +1,293 @@
+package xds
+
+import (
+	"sort"
+	"strings"
+)
+
+// ResourceStatus describes how Envoy has responded to the current
+// version of a resource.
+type ResourceStatus struct {
+	// Acked is true if at least one Envoy has accepted the
+	// current version of the resource.
+	Acked bool
+
+	// Errors holds the error messages from each Envoy that has
+	// rejected the current version of the resource.
+	Errors []string
+
+	// Held is true if the resource is held back from Envoy
+	// because its references don't resolve.
+	Held bool
+}
+
+// streamKey uniquely identifies an xDS stream across the v2 and v3
+// servers, and the delta streams that we serve ourselves.
+type streamKey struct {
+	Version EnvoyVersion
+	Delta   bool
+	ID      int64
+}
+
+// sentResponse records the most recent response of a given type
+// that was sent on a stream.
+type sentResponse struct {
+	Nonce   string
+	Version uint64
+}
+
+// streamState tracks the responses sent on an xDS stream so that
+// Envoy ACKs and NACKs can be attributed to resources.
+type streamState struct {
+	Group string
+	Sent  map[string]sentResponse
+	Acked map[string]uint64
+}
+
+// ResourceStatus returns the Envoy status of the named resource.
+func (srv *Server) ResourceStatus(name ResourceName) ResourceStatus {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	r, ok := srv.resources[name]
+	if !ok {
+		return ResourceStatus{}
+	}
+
+	status := r.status()
+	status.Held = srv.isHeld(name)
+
+	return status
+}
+
+// Notify registers a function that is called with the name of
+// each resource whose status changes.
+func (srv *Server) Notify(f func(ResourceName)) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.notifiers = append(srv.notifiers, f)
+}
+
+// notify calls the registered notifiers for each of the given
+// resources. The caller must not hold the resource table lock.
+func (srv *Server) notify(names []ResourceName) {
+	srv.lock.Lock()
+	notifiers := srv.notifiers
+	srv.lock.Unlock()
+
+	for _, n := range names {
+		for _, f := range notifiers {
+			f(n)
+		}
+	}
+}
+
+// streamResponse records a response that is about to be sent on a stream.
+func (srv *Server) streamResponse(key streamKey, group string, typeURL string, nonce string, version string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	vers, ok := srv.parseVersion(version)
+	if !ok {
+		return
+	}
+
+	stream := srv.stream(key, group)
+	stream.Sent[typeURL] = sentResponse{Nonce: nonce, Version: vers}
+}
+
+// streamRequest processes the ACK or NACK carried by a discovery request.
+func (srv *Server) streamRequest(key streamKey, group string, typeURL string, nonce string, errorDetail string) {
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	stream := srv.stream(key, group)
+
+	// If the nonce doesn't match the most recent response
+	// of this type, then the request is stale (or is the
+	// initial request) and we can ignore it.
+	sent, ok := stream.Sent[typeURL]
+	if !ok || nonce == "" || sent.Nonce != nonce {
+		return
+	}
+
+	if errorDetail == "" {
+		stream.Acked[typeURL] = sent.Version
+		changed = srv.ackResources(key, stream, typeURL, sent.Version)
+
+		return
+	}
+
+	changed = srv.nackResources(key, stream, typeURL, sent.Version, errorDetail)
+}
+
+// streamClosed discards the state for a stream, and any NACKs that
+// the stream was holding against resources.
+func (srv *Server) streamClosed(key streamKey) {
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.streams, key)
+
+	for name, r := range srv.resources {
+		if _, ok := r.Nacks[key]; ok {
+			delete(r.Nacks, key)
+			changed = append(changed, name)
+		}
+	}
+}
+
+// stream returns the state for the given stream, creating it if
+// necessary. The caller must hold the resource table lock.
+func (srv *Server) stream(key streamKey, group string) *streamState {
+	s, ok := srv.streams[key]
+	if !ok {
+		s = &streamState{
+			Group: group,
+			Sent:  map[string]sentResponse{},
+			Acked: map[string]uint64{},
+		}
+
+		srv.streams[key] = s
+	}
+
+	return s
+}
+
+// ackResources marks all the resources of the given type that were
+// published to the stream at or before version as accepted. The caller
+// must hold the resource table lock.
+func (srv *Server) ackResources(key streamKey, stream *streamState, typeURL string, version uint64) []ResourceName {
+	var changed []ResourceName
+
+	for name, r := range srv.resources {
+		if r.messageFor(typeURL) == nil || !r.Nodes.Matches(stream.Group) || r.Changed > version || srv.isHeld(name) {
+			continue
+		}
+
+		_, nacked := r.Nacks[key]
+
+		if !r.Acked || nacked {
+			r.Acked = true
+			delete(r.Nacks, key)
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// nackResources attributes a NACK to the resources that Envoy most
+// likely rejected. Envoy usually names the offending resource in its
+// error message, so that is the first choice. Otherwise, we blame the
+// resources that changed since the stream last ACKed this type, and
+// as a last resort, all the resources in the rejected response. The
+// caller must hold the resource table lock.
+func (srv *Server) nackResources(
+	key streamKey, stream *streamState, typeURL string, version uint64, errorDetail string,
+) []ResourceName {
+	var named, updated, all []ResourceName
+
+	for name, r := range srv.resources {
+		if r.messageFor(typeURL) == nil || !r.Nodes.Matches(stream.Group) || r.Changed > version || srv.isHeld(name) {
+			continue
+		}
+
+		all = append(all, name)
+
+		if n := NameOf(r.Message); n != "" && mentionsName(errorDetail, n) {
+			named = append(named, name)
+		}
+
+		if r.Changed > stream.Acked[typeURL] {
+			updated = append(updated, name)
+		}
+	}
+
+	blamed := all
+
+	switch {
+	case len(named) > 0:
+		blamed = named
+	case len(updated) > 0:
+		blamed = updated
+	}
+
+	for _, name := range blamed {
+		r := srv.resources[name]
+		if r.Nacks == nil {
+			r.Nacks = map[streamKey]string{}
+		}
+
+		r.Nacks[key] = errorDetail
+	}
+
+	return blamed
+}
+
+// isNameChar returns true if c can be part of an Envoy resource name.
+func isNameChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("-_./:", c) >= 0
+	}
+}
+
+// mentionsName returns true if the error message contains name as a
+// whole token, so that "foo" doesn't match "foo-tls", and a short name
+// doesn't match part of a word. A trailing "." or ":" is punctuation
+// rather than part of the name when it isn't followed by another name
+// character (e.g. "listener foo: bind failed").
+func mentionsName(message string, name string) bool {
+	for i := 0; i+len(name) <= len(message); i++ {
+		if message[i:i+len(name)] != name {
+			continue
+		}
+
+		if i > 0 && isNameChar(message[i-1]) {
+			continue
+		}
+
+		end := i + len(name)
+
+		switch {
+		case end == len(message), !isNameChar(message[end]):
+			return true
+		case message[end] == '.' || message[end] == ':':
+			if end+1 == len(message) || !isNameChar(message[end+1]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// status returns the ResourceStatus for this resource entry.
+func (r *resourceEntry) status() ResourceStatus {
+	errors := map[string]struct{}{}
+	status := ResourceStatus{Acked: r.Acked}
+
+	for _, e := range r.Nacks {
+		errors[e] = struct{}{}
+	}
+
+	for e := range errors {
+		status.Errors = append(status.Errors, e)
+	}
+
+	sort.Strings(status.Errors)
+
+	return status
+}
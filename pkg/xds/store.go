@@ -15,10 +15,42 @@ type ResourceVersion struct {
 // ResourceName is a globally unique name for an xDS resource.
 type ResourceName string
 
+// NodeSelector lists the Envoy node groups that a resource is
+// published to. Envoy nodes are grouped by their service cluster
+// name. An empty NodeSelector selects every node group.
+type NodeSelector []string
+
+// Matches returns true if the selector selects the given node group.
+func (n NodeSelector) Matches(group string) bool {
+	if len(n) == 0 {
+		return true
+	}
+
+	for _, g := range n {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ResourceStore represents a store of Envoy resources. The resources
 // are indexed and referred to by globally unique names. Resource stores
 // are expected to map resources to Envoy API versions internally, if necessary.
 type ResourceStore interface {
-	UpdateResource(ResourceName, ResourceVersion, proto.Message)
+	UpdateResource(ResourceName, ResourceVersion, NodeSelector, proto.Message) error
 	DeleteResource(ResourceName)
+	// RejectResource records that the named resource was rejected
+	// before it could be stored, leaving any stored version in place.
+	RejectResource(ResourceName)
+
+	// ResourceStatus returns the Envoy status of the named resource.
+	ResourceStatus(ResourceName) ResourceStatus
+	// UnresolvedReferences returns the references from the named
+	// resource to resources that are not published.
+	UnresolvedReferences(ResourceName) []Reference
+	// Notify registers a function that is called with the name
+	// of each resource whose status or references change.
+	Notify(func(ResourceName))
 }
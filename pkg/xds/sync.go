@@ -0,0 +1,148 @@
+package xds
+
+// syncState tracks the resource source while the server is holding
+// back snapshots until it has synced.
+type syncState struct {
+	// Handled is the set of resources that the source has stored,
+	// deleted or rejected since the hold began.
+	Handled map[ResourceName]struct{}
+
+	// Current is the set of resources that the source has, which
+	// is nil until MarkSynced is called.
+	Current map[ResourceName]struct{}
+
+	// Waiting is the set of current resources that the source
+	// hasn't handled yet.
+	Waiting map[ResourceName]struct{}
+}
+
+// HoldUntilSynced holds back every snapshot until the resource source
+// has synced (see MarkSynced). Envoy waits for its first snapshot, or
+// keeps the snapshot that it has, so a controller that is starting up
+// never withdraws resources because it has only seen some of them. A
+// snapshot that was restored from disk is still served (see Restore).
+func (srv *Server) HoldUntilSynced() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.holdUntilSynced()
+}
+
+// holdUntilSynced starts holding back snapshots. The caller must hold
+// the resource table lock.
+func (srv *Server) holdUntilSynced() {
+	if srv.syncing != nil {
+		return
+	}
+
+	srv.syncing = &syncState{Handled: map[ResourceName]struct{}{}}
+}
+
+// MarkSynced tells the server the current set of resources once the
+// resource source has synced. The hold started by HoldUntilSynced or
+// Restore ends when the source has stored, deleted or rejected each
+// of the current resources, so that the first snapshot is complete.
+// Restored resources that are not in the current set were deleted
+// while the server was down, so they are removed. Restored resources
+// that are in the current set are kept until they are updated. The
+// resulting snapshot is then published.
+func (srv *Server) MarkSynced(current []ResourceName) {
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.syncing == nil || srv.syncing.Current != nil {
+		return
+	}
+
+	srv.syncing.Current = map[ResourceName]struct{}{}
+	srv.syncing.Waiting = map[ResourceName]struct{}{}
+
+	for _, n := range current {
+		srv.syncing.Current[n] = struct{}{}
+
+		if _, ok := srv.syncing.Handled[n]; !ok {
+			srv.syncing.Waiting[n] = struct{}{}
+		}
+	}
+
+	if len(srv.syncing.Waiting) == 0 {
+		changed = srv.endSync()
+		return
+	}
+
+	srv.log.Info("waiting for resources to sync",
+		"resources", len(srv.syncing.Current), "waiting", len(srv.syncing.Waiting))
+}
+
+// RejectResource records that the resource source rejected the named
+// resource, so that it was never stored. The version of the resource
+// that is already stored, if any, is kept.
+func (srv *Server) RejectResource(name ResourceName) {
+	var changed []ResourceName
+
+	defer func() { srv.notify(changed) }()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	changed = srv.syncResource(name)
+}
+
+// Synced returns true unless the server is holding back snapshots
+// until the resource source has synced.
+func (srv *Server) Synced() bool {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	return srv.syncing == nil
+}
+
+// syncResource records that the resource source has handled the named
+// resource. If it was the last resource that the server was waiting
+// for, the hold ends and the snapshot is published, and the names of
+// the changed resources are returned. The caller must hold the
+// resource table lock.
+func (srv *Server) syncResource(name ResourceName) []ResourceName {
+	if srv.syncing == nil {
+		return nil
+	}
+
+	if srv.syncing.Current == nil {
+		srv.syncing.Handled[name] = struct{}{}
+		return nil
+	}
+
+	if _, ok := srv.syncing.Waiting[name]; !ok {
+		return nil
+	}
+
+	delete(srv.syncing.Waiting, name)
+
+	if len(srv.syncing.Waiting) > 0 {
+		return nil
+	}
+
+	return srv.endSync()
+}
+
+// endSync ends the hold, removes the restored resources that the
+// source no longer has, and publishes the resulting snapshot. The
+// caller must hold the resource table lock.
+func (srv *Server) endSync() []ResourceName {
+	var changed []ResourceName
+
+	current := srv.syncing.Current
+	srv.syncing = nil
+
+	for name, r := range srv.resources {
+		if _, ok := current[name]; r.Restored && !ok {
+			changed = append(changed, srv.remove(name)...)
+		}
+	}
+
+	return append(changed, srv.publish()...)
+}
@@ -0,0 +1,84 @@
+package xds
+
+import (
+	"testing"
+
+	clusterV3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	resourceV3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerHoldsUntilSynced(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+	srv.HoldUntilSynced()
+
+	assert.False(t, srv.Synced())
+
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"}))
+
+	// Nothing is served until the source has synced.
+	_, err := srv.cacheV3.GetSnapshot("")
+	assert.Error(t, err)
+
+	sub := &deltaSubscription{
+		TypeURL: resourceV3.ClusterType,
+		Names:   map[string]struct{}{},
+		Sent:    map[string]string{},
+	}
+
+	key := streamKey{Version: EnvoyVersion3, Delta: true, ID: 1}
+	assert.Nil(t, srv.deltaResponse(key, "", sub, "1"))
+
+	srv.MarkSynced([]ResourceName{"default/cluster/one"})
+
+	assert.True(t, srv.Synced())
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+	assert.Contains(t, snap.GetResources(resourceV3.ClusterType), "one")
+
+	assert.NotNil(t, srv.deltaResponse(key, "", sub, "2"))
+}
+
+func TestServerWaitsForCurrentResources(t *testing.T) {
+	srv := NewServer()
+	srv.observeNodeGroup("")
+	srv.HoldUntilSynced()
+
+	require.NoError(t, srv.UpdateResource("default/cluster/one",
+		ResourceVersion{Identifier: "1", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "one"}))
+
+	srv.MarkSynced([]ResourceName{
+		"default/cluster/one",
+		"default/cluster/two",
+		"default/cluster/three",
+		"default/cluster/four",
+	})
+
+	// The source hasn't handled all of the current resources.
+	assert.False(t, srv.Synced())
+
+	require.NoError(t, srv.UpdateResource("default/cluster/two",
+		ResourceVersion{Identifier: "2", Version: "1"}, nil,
+		&clusterV3.Cluster{Name: "two"}))
+	srv.RejectResource("default/cluster/three")
+
+	assert.False(t, srv.Synced())
+
+	_, err := srv.cacheV3.GetSnapshot("")
+	assert.Error(t, err)
+
+	// Deleting a resource that was never stored handles it.
+	srv.DeleteResource("default/cluster/four")
+
+	assert.True(t, srv.Synced())
+
+	snap, err := srv.cacheV3.GetSnapshot("")
+	require.NoError(t, err)
+	assert.Len(t, snap.GetResources(resourceV3.ClusterType), 2)
+}
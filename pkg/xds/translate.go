@@ -0,0 +1,162 @@
+package xds
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	udpa "github.com/cncf/udpa/go/udpa/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var (
+	upgradesOnce sync.Once
+	upgrades     map[protoreflect.FullName]protoreflect.MessageType
+)
+
+// upgradeFor returns the v3 message type that replaces the given v2
+// message, or nil if there isn't one. Each v3 message records the v2
+// message that it replaces in its versioning annotation, so we can
+// find all the upgrades by scanning the registered message types.
+func upgradeFor(name protoreflect.FullName) protoreflect.MessageType {
+	upgradesOnce.Do(func() {
+		upgrades = map[protoreflect.FullName]protoreflect.MessageType{}
+
+		protoregistry.GlobalTypes.RangeMessages(func(m protoreflect.MessageType) bool {
+			desc := m.Descriptor()
+
+			// Only upgrade to v3, since the v4alpha messages
+			// replace the v3 ones.
+			if strings.HasSuffix(string(desc.ParentFile().Package()), "v4alpha") {
+				return true
+			}
+
+			vers, ok := proto.GetExtension(desc.Options(), udpa.E_Versioning).(*udpa.VersioningAnnotation)
+			if ok && vers.GetPreviousMessageType() != "" {
+				upgrades[protoreflect.FullName(vers.GetPreviousMessageType())] = m
+			}
+
+			return true
+		})
+	})
+
+	return upgrades[name]
+}
+
+// TranslateV3 upgrades a v2 Envoy message to its v3 equivalent. The
+// v3 API is wire compatible with v2 (removed fields are renamed, not
+// renumbered), so the message is translated by re-encoding it as the
+// v3 type. Messages embedded in Any fields (e.g. filter configurations)
+// are translated the same way.
+func TranslateV3(message proto.Message) (proto.Message, error) {
+	name := message.ProtoReflect().Descriptor().FullName()
+
+	upgraded := upgradeFor(name)
+	if upgraded == nil {
+		return nil, fmt.Errorf("no v3 equivalent for %q", name)
+	}
+
+	return translateAs(message, upgraded)
+}
+
+// translateAs re-encodes message as the given message type, then
+// translates any nested Any fields.
+func translateAs(message proto.Message, messageType protoreflect.MessageType) (proto.Message, error) {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %q: %w", message.ProtoReflect().Descriptor().FullName(), err)
+	}
+
+	translated := messageType.New()
+
+	if err := proto.Unmarshal(data, translated.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to translate to %q: %w", messageType.Descriptor().FullName(), err)
+	}
+
+	if err := translateNested(translated); err != nil {
+		return nil, err
+	}
+
+	return translated.Interface(), nil
+}
+
+// translateNested walks the fields of a message, translating the
+// contents of any Any fields that hold v2 messages.
+func translateNested(m protoreflect.Message) error {
+	var err error
+
+	translateMessage := func(v protoreflect.Message) error {
+		if a, ok := v.Interface().(*Any); ok {
+			return translateAny(a)
+		}
+
+		return translateNested(v)
+	}
+
+	m.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() != protoreflect.MessageKind && field.Kind() != protoreflect.GroupKind {
+			return true
+		}
+
+		switch {
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = translateMessage(list.Get(i).Message())
+			}
+		case field.IsMap():
+			if field.MapValue().Kind() != protoreflect.MessageKind {
+				return true
+			}
+
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				err = translateMessage(v.Message())
+				return err == nil
+			})
+		default:
+			err = translateMessage(value.Message())
+		}
+
+		return err == nil
+	})
+
+	return err
+}
+
+// translateAny replaces the contents of an Any with the v3 equivalent.
+// Types that aren't versioned Envoy messages are left alone.
+func translateAny(a *Any) error {
+	name := protoreflect.FullName(a.GetTypeUrl()[strings.LastIndex(a.GetTypeUrl(), "/")+1:])
+
+	upgraded := upgradeFor(name)
+	if upgraded == nil {
+		return nil
+	}
+
+	previous, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		return fmt.Errorf("protobuf message type %q: %w", name, err)
+	}
+
+	message := previous.New().Interface()
+	if err := proto.Unmarshal(a.GetValue(), message); err != nil {
+		return fmt.Errorf("failed to unmarshal %q: %w", name, err)
+	}
+
+	translated, err := translateAs(message, upgraded)
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(translated)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %q: %w", upgraded.Descriptor().FullName(), err)
+	}
+
+	a.TypeUrl = TypeURL(translated)
+	a.Value = data
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package xds
+
+import (
+	"testing"
+
+	apiV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	listenerV2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	hcmV2 "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	listenerV3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmV3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateV3(t *testing.T) {
+	hcm, err := MarshalAny(&hcmV2.HttpConnectionManager{StatPrefix: "ingress"})
+	require.NoError(t, err)
+
+	translated, err := TranslateV3(&apiV2.Listener{
+		Name: "ingress",
+		FilterChains: []*listenerV2.FilterChain{{
+			Filters: []*listenerV2.Filter{{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &listenerV2.Filter_TypedConfig{TypedConfig: hcm},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	listener, ok := translated.(*listenerV3.Listener)
+	require.True(t, ok, "translated %T", translated)
+	assert.Equal(t, "ingress", listener.GetName())
+
+	// The nested filter configuration is translated too.
+	typed := listener.GetFilterChains()[0].GetFilters()[0].GetTypedConfig()
+	assert.Equal(t, TypeURL(&hcmV3.HttpConnectionManager{}), typed.GetTypeUrl())
+
+	config, err := UnmarshalAny(typed)
+	require.NoError(t, err)
+	assert.Equal(t, "ingress", config.(*hcmV3.HttpConnectionManager).GetStatPrefix())
+
+	// v3 messages don't need translating.
+	_, err = TranslateV3(listener)
+	assert.Error(t, err)
+}